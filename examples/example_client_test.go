@@ -1,28 +1,19 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"log"
-	"net/http"
+	"time"
 
 	"github.com/lrh3321/gorilla-xmlrpc/xml"
 )
 
-func XmlRpcCall(method string, args struct{ Who string }) (reply struct{ Message string }, err error) {
-	buf, _ := xml.EncodeClientRequest(method, &args)
-
-	resp, err := http.Post("http://localhost:1234/RPC2", "text/xml", bytes.NewBuffer(buf))
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	err = xml.DecodeClientResponse(resp.Body, &reply)
-	return
-}
-
 func main() {
-	reply, err := XmlRpcCall("HelloService.Say", struct{ Who string }{"User 1"})
+	client := xml.NewClient("http://localhost:1234/RPC2", nil)
+	client.SetTimeout(5 * time.Second)
+
+	var reply struct{ Message string }
+	err := client.Call(context.Background(), "HelloService.Say", &struct{ Who string }{"User 1"}, &reply)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,122 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Batch queues calls to be sent in a single system.multicall request.
+type Batch struct {
+	calls []*BatchCall
+}
+
+// BatchCall is a call queued in a Batch.
+type BatchCall struct {
+	Method string
+	Args   interface{}
+	Reply  interface{}
+	// Error is set once the response is decoded, if this call failed.
+	// A fault sent by the server for this call is a Fault.
+	Error error
+}
+
+// Add queues a call of method with args, whose result will be decoded into
+// reply, and returns it. args and reply follow the same rules as
+// EncodeClientRequest and DecodeClientResponse; both may be nil.
+func (b *Batch) Add(method string, args, reply interface{}) *BatchCall {
+	call := &BatchCall{Method: method, Args: args, Reply: reply}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Len returns the number of queued calls.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// batchEntry is the {methodName, params} struct of a multicall request.
+type batchEntry struct {
+	MethodName string        `xmlrpc:"methodName"`
+	Params     []interface{} `xmlrpc:"params"`
+}
+
+// EncodeRequest encodes the queued calls as a system.multicall request.
+func (b *Batch) EncodeRequest() ([]byte, error) {
+	return EncodeClientRequest("system.multicall", b.entries())
+}
+
+// entries returns the entries of the system.multicall request of the queued
+// calls.
+func (b *Batch) entries() []batchEntry {
+	entries := make([]batchEntry, len(b.calls))
+	for i, call := range b.calls {
+		entries[i].MethodName = call.Method
+		entries[i].Params = []interface{}{}
+		if call.Args != nil {
+			entries[i].Params = paramValues(call.Args)
+		}
+	}
+	return entries
+}
+
+// DecodeResponse decodes the response to a system.multicall request into
+// the replies of the queued calls.
+//
+// The returned error concerns the response as a whole. Calls which failed
+// on their own have their Error set, while the replies of the others are
+// filled in.
+func (b *Batch) DecodeResponse(r io.Reader) error {
+	return b.decodeResponse(NewDecoder(r))
+}
+
+func (b *Batch) decodeResponse(d *Decoder) error {
+	ret, err := d.readMessage()
+	if err != nil {
+		return err
+	}
+	if !ret.Fault.IsEmpty() {
+		return getFaultResponse(ret.Fault)
+	}
+	if len(ret.Params) != 1 {
+		return FaultWrongArgumentsNumber
+	}
+
+	results := ret.Params[0].Value.Array
+	if len(results) != len(b.calls) {
+		fault := FaultInvalidParams
+		fault.String += fmt.Sprintf(": got %d results for %d calls", len(results), len(b.calls))
+		return fault
+	}
+	for i, result := range results {
+		call := b.calls[i]
+		if len(result.Struct) != 0 {
+			call.Error = getFaultResponse(faultValue{Value: result})
+			continue
+		}
+		if call.Reply == nil {
+			continue
+		}
+		params := make([]param, len(result.Array))
+		for j, v := range result.Array {
+			params[j] = param{Value: v}
+		}
+		call.Error = d.params2RPC(params, call.Reply)
+	}
+	return nil
+}
+
+// CallBatch sends the calls queued in b in a single system.multicall request
+// and decodes their results, see Batch.DecodeResponse.
+func (c *Client) CallBatch(ctx context.Context, b *Batch) error {
+	encode := func(w io.Writer) error {
+		return c.newEncoder(w).EncodeRequest("system.multicall", b.entries())
+	}
+	return c.do(ctx, encode, func(r io.Reader) error {
+		return b.decodeResponse(c.newDecoder(r))
+	})
+}
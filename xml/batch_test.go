@@ -0,0 +1,70 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/rpc"
+)
+
+func TestBatchEncodeRequest(t *testing.T) {
+	var b Batch
+	b.Add("Service1.Multiply", &Service1Request{4, 2}, nil)
+	b.Add("Service1.Ping", nil, nil)
+	buf, err := b.EncodeRequest()
+	if err != nil {
+		t.Error("Batch encoding failed", err)
+	}
+	expected := "<methodCall><methodName>system.multicall</methodName><params><param><value><array><data>" +
+		"<value><struct><member><name>methodName</name><value><string>Service1.Multiply</string></value></member><member><name>params</name><value><array><data><value><int>4</int></value><value><int>2</int></value></data></array></value></member></struct></value>" +
+		"<value><struct><member><name>methodName</name><value><string>Service1.Ping</string></value></member><member><name>params</name><value><array><data></data></array></value></member></struct></value>" +
+		"</data></array></value></param></params></methodCall>"
+	if string(buf) != expected {
+		t.Error("Batch encoding failed")
+		t.Error("Expected", expected)
+		t.Error("Got", string(buf))
+	}
+}
+
+func TestClientCallBatch(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	codec.RegisterService(s, new(Service1), "")
+	codec.RegisterService(s, new(Service2), "")
+	codec.EnableMulticall(s)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var (
+		b    Batch
+		res1 Service1Response
+		res2 Service2Response
+		res3 Service1Response
+	)
+	call1 := b.Add("Service1.Multiply", &Service1Request{4, 2}, &res1)
+	call2 := b.Add("Service2.GetGreeting", &Service2Request{"Johnny", 33, false}, &res2)
+	call3 := b.Add("Service1.Missing", &Service1Request{4, 2}, &res3)
+
+	if err := NewClient(ts.URL, nil).CallBatch(context.Background(), &b); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if call1.Error != nil || res1.Result != 8 {
+		t.Errorf("Wrong response: %v, %v.", res1.Result, call1.Error)
+	}
+	if call2.Error != nil || res2.Message != "Hello, user Johnny. You're 33 years old :-P And you DON'T has permit." {
+		t.Errorf("Wrong response: %v, %v.", res2.Message, call2.Error)
+	}
+	fault, ok := call3.Error.(Fault)
+	if !ok {
+		t.Fatal("expected error to be of concrete type Fault, but got", call3.Error)
+	}
+	if fault.Code != FaultMethodNotFound.Code {
+		t.Errorf("wrong fault code: %d", fault.Code)
+	}
+}
@@ -5,22 +5,200 @@
 package xml
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
 )
 
 // EncodeClientRequest encodes parameters for a XML-RPC client request.
 func EncodeClientRequest(method string, args ...interface{}) ([]byte, error) {
-	xml, err := rpcRequest2XML(method, args...)
-	return []byte(xml), err
+	var buffer bytes.Buffer
+	err := NewEncoder(&buffer).EncodeRequest(method, args...)
+	return buffer.Bytes(), err
 }
 
 // DecodeClientResponse decodes the response body of a client request into
-// the interface reply.
+// the interface reply, which must be nil, to discard the params, or a
+// non-nil pointer.
 func DecodeClientResponse(r io.Reader, reply interface{}) error {
-	rawxml, err := ioutil.ReadAll(r)
+	return NewDecoder(r).DecodeResponse(reply)
+}
+
+// ----------------------------------------------------------------------------
+// Client
+// ----------------------------------------------------------------------------
+
+// NewClient returns a new XML-RPC Client sending calls to the url endpoint.
+//
+// httpClient is used to send the requests, http.DefaultClient if it's nil.
+func NewClient(url string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		httpClient: httpClient,
+		url:        url,
+		header:     make(http.Header),
+		timeLayout: DateTimeLayout,
+		loc:        time.UTC,
+	}
+}
+
+// Client sends XML-RPC calls over HTTP.
+type Client struct {
+	httpClient *http.Client
+	url        string
+	header     http.Header
+	username   string
+	password   string
+	timeout    time.Duration
+	strict     bool
+	coercion   Coercion
+	extensions bool
+	timeLayout string
+	loc        *time.Location
+}
+
+// SetHeader sets a header sent with every request.
+func (c *Client) SetHeader(key, value string) {
+	c.header.Set(key, value)
+}
+
+// SetBasicAuth makes every request use HTTP Basic Authentication with the
+// provided username and password.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.username = username
+	c.password = password
+}
+
+// SetTimeout limits the time a single call may take, including reading the
+// response. A zero timeout means no limit other than the one of ctx.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetStrict makes the client decode responses strictly, see
+// Decoder.SetStrict.
+func (c *Client) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// SetCoercion sets the type conversions made decoding responses, see
+// Decoder.SetCoercion.
+func (c *Client) SetCoercion(coercion Coercion) {
+	c.coercion = coercion
+}
+
+// SetExtensions enables the Apache XML-RPC extension types, encoding
+// requests and decoding responses, see Encoder.SetExtensions and
+// Decoder.SetExtensions.
+func (c *Client) SetExtensions(enabled bool) {
+	c.extensions = enabled
+}
+
+// SetTimeLayout sets the layout of the times of requests, see
+// Encoder.SetTimeLayout.
+func (c *Client) SetTimeLayout(layout string) {
+	c.timeLayout = layout
+}
+
+// SetTimeLocation sets the location times of requests are converted to and
+// times of responses without offset are decoded in, see
+// Encoder.SetTimeLocation and Decoder.SetTimeLocation.
+func (c *Client) SetTimeLocation(loc *time.Location) {
+	c.loc = loc
+}
+
+// newDecoder returns a decoder of a response body, set up as the client.
+func (c *Client) newDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.SetStrict(c.strict)
+	d.SetCoercion(c.coercion)
+	d.SetExtensions(c.extensions)
+	d.SetTimeLocation(c.loc)
+	return d
+}
+
+// newEncoder returns an encoder of a request body, set up as the client.
+func (c *Client) newEncoder(w io.Writer) *Encoder {
+	e := NewEncoder(w)
+	e.SetExtensions(c.extensions)
+	e.SetTimeLayout(c.timeLayout)
+	e.SetTimeLocation(c.loc)
+	return e
+}
+
+// Call sends a call of method with args and decodes the response into reply.
+//
+// args and reply follow the same rules as EncodeClientRequest and
+// DecodeClientResponse: a nil reply discards the response params. A fault
+// sent by the server is returned as a Fault.
+func (c *Client) Call(ctx context.Context, method string, args, reply interface{}) error {
+	var params []interface{}
+	if args != nil {
+		params = append(params, args)
+	}
+	encode := func(w io.Writer) error {
+		return c.newEncoder(w).EncodeRequest(method, params...)
+	}
+	return c.do(ctx, encode, func(r io.Reader) error {
+		return c.newDecoder(r).DecodeResponse(reply)
+	})
+}
+
+// do posts the request body written by encode and decodes the response with
+// decode. The body is encoded as it's sent, rather than in memory first.
+func (c *Client) do(ctx context.Context, encode func(w io.Writer) error, decode func(r io.Reader) error) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	encoded := make(chan error, 1)
+	go func() {
+		err := encode(pw)
+		pw.CloseWithError(err)
+		encoded <- err
+	}()
+
+	req, err := http.NewRequest("POST", c.url, pr)
 	if err != nil {
-		return FaultSystemError
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// A request failing because its body couldn't be encoded reports
+		// why.
+		pr.Close()
+		if encodeErr := <-encoded; encodeErr != nil && encodeErr != io.ErrClosedPipe {
+			return encodeErr
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("xml: unexpected HTTP status %q", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/xml" && mediaType != "application/xml" {
+		return fmt.Errorf("xml: unexpected Content-Type %q", contentType)
 	}
-	return xml2RPC(string(rawxml), reply)
+	return decode(resp.Body)
 }
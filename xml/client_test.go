@@ -0,0 +1,162 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc"
+)
+
+func newTestServer() *httptest.Server {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "text/xml")
+	s.RegisterService(new(Service1), "")
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); ok && (user != "user" || pass != "secret") {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if token := r.Header.Get("X-Token"); token != "" && token != "token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+}
+
+func TestClientCall(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	client.SetBasicAuth("user", "secret")
+	client.SetHeader("X-Token", "token")
+
+	var res Service1Response
+	if err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if res.Result != 8 {
+		t.Errorf("Wrong response: %v.", res.Result)
+	}
+}
+
+func TestClientEncodeError(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+
+	var res Service1Response
+	err := client.Call(context.Background(), "Service1.Multiply", &struct{ C chan int }{}, &res)
+	if _, ok := err.(*UnsupportedTypeError); !ok {
+		t.Fatal("expected error to be of concrete type UnsupportedTypeError, but got", err)
+	}
+}
+
+func TestClientHTTPErrors(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	client.SetBasicAuth("user", "wrong")
+
+	var res Service1Response
+	err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("expected HTTP status error, but got: %v", err)
+	}
+
+	client = NewClient(ts.URL, nil)
+	client.SetHeader("X-Token", "wrong")
+	err = client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("expected HTTP status error, but got: %v", err)
+	}
+
+	client = NewClient(ts.URL, nil)
+	err = client.Call(context.Background(), "Service1.Missing", &Service1Request{4, 2}, &res)
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("expected HTTP status error, but got: %v", err)
+	}
+}
+
+func TestClientContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+
+	var res Service1Response
+	err := NewClient(ts.URL, nil).Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res)
+	if err == nil || !strings.Contains(err.Error(), "text/html") {
+		t.Errorf("expected Content-Type error, but got: %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	client.SetTimeout(10 * time.Millisecond)
+
+	var res Service1Response
+	err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected timeout error, but got: %v", err)
+	}
+}
+
+func TestClientStrict(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte("<methodResponse><params><param><value><struct>" +
+			"<member><name>Result</name><value><int>1</int></value></member>" +
+			"<member><name>Result</name><value><int>2</int></value></member>" +
+			"</struct></value></param></params></methodResponse>"))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	var res struct{ Reply Service1Response }
+	if err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res); err != nil || res.Reply.Result != 2 {
+		t.Errorf("Wrong response: %v, %v.", res.Reply.Result, err)
+	}
+
+	client.SetStrict(true)
+	err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res)
+	if _, ok := err.(*DecodeError); !ok || !strings.Contains(err.Error(), `duplicate member "Result"`) {
+		t.Errorf("expected duplicate member error, but got %v", err)
+	}
+}
+
+func TestClientCoercion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte("<methodResponse><params><param><value><string>8</string></value></param></params></methodResponse>"))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	var res struct{ Result int }
+	if err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res); err == nil {
+		t.Error("expected a type mismatch without coercion")
+	}
+
+	client.SetCoercion(CoerceNumericStrings)
+	if err := client.Call(context.Background(), "Service1.Multiply", &Service1Request{4, 2}, &res); err != nil || res.Result != 8 {
+		t.Errorf("Wrong response: %v, %v.", res.Result, err)
+	}
+}
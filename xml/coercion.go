@@ -0,0 +1,116 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Coercion is a set of type conversions a Decoder may make when the type of
+// a value doesn't match the Go type it's decoded into. Without them, such a
+// value fails with a type mismatch.
+type Coercion uint
+
+const (
+	// CoerceNumericStrings decodes a <string> holding a number into any
+	// integer or float kind.
+	CoerceNumericStrings Coercion = 1 << iota
+	// CoerceIntToFloat decodes an <int>, <i4> or <i8> into any float kind.
+	CoerceIntToFloat
+	// CoerceIntToBool decodes an <int>, <i4> or <i8> of 0 or 1 into a bool.
+	CoerceIntToBool
+	// CoerceScalarToSlice decodes a value other than an array or a struct
+	// into a slice holding it as its single element.
+	CoerceScalarToSlice
+
+	// CoerceNone makes no conversion. It's the default.
+	CoerceNone Coercion = 0
+	// CoerceAll makes every conversion.
+	CoerceAll = CoerceNumericStrings | CoerceIntToFloat | CoerceIntToBool | CoerceScalarToSlice
+)
+
+// SetCoercion sets the type conversions the decoder makes, for peers which
+// are sloppy about types.
+func (d *Decoder) SetCoercion(c Coercion) {
+	d.coercion = c
+}
+
+// coerce decodes value into field through one of the conversions of the
+// decoder, and reports whether one applies.
+func (d *Decoder) coerce(value value, field *reflect.Value) (bool, error) {
+	if d.coercion == CoerceNone {
+		return false, nil
+	}
+
+	kind := field.Kind()
+	switch value.Type {
+	case "int", "i4", "i8", "ex:i1", "ex:i2", "ex:i8":
+		switch {
+		case d.coercion&CoerceIntToFloat != 0 && (kind == reflect.Float32 || kind == reflect.Float64):
+			i, err := strconv.ParseInt(strings.TrimSpace(value.Text), 10, 64)
+			if err != nil {
+				return true, err
+			}
+			return true, float2Field(float64(i), field)
+		case d.coercion&CoerceIntToBool != 0 && kind == reflect.Bool:
+			i, err := strconv.ParseInt(strings.TrimSpace(value.Text), 10, 64)
+			if err != nil {
+				return true, err
+			}
+			if i != 0 && i != 1 {
+				return true, fmt.Errorf("%d isn't a boolean", i)
+			}
+			field.SetBool(i == 1)
+			return true, nil
+		}
+	case "string", "":
+		if d.coercion&CoerceNumericStrings == 0 {
+			break
+		}
+		text := strings.TrimSpace(value.Text)
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			i, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return true, err
+			}
+			return true, int2Field(i, field)
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return true, err
+			}
+			return true, float2Field(f, field)
+		}
+	}
+
+	if d.coercion&CoerceScalarToSlice != 0 && kind == reflect.Slice && isScalar(value, field.Type()) {
+		slice := reflect.MakeSlice(field.Type(), 1, 1)
+		item := slice.Index(0)
+		if err := d.value2Field(value, &item); err != nil {
+			return true, decodePath(err, "[0]")
+		}
+		field.Set(slice)
+		return true, nil
+	}
+	return false, nil
+}
+
+// isScalar reports whether value is a scalar as decoded into a slice of
+// type t: anything but an array, a struct, a nil, or a base64 decoded into
+// a []byte.
+func isScalar(value value, t reflect.Type) bool {
+	switch value.Type {
+	case "array", "struct", "nil", "ex:nil":
+		return false
+	case "base64":
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type CoercionStruct struct {
+	Int    int
+	Uint   uint8
+	Float  float64
+	Ratio  float32
+	Flag   bool
+	Tags   []string
+	Counts []int
+	Data   []byte
+}
+
+func TestXML2RPCCoercion(t *testing.T) {
+	value := "<value><struct>" +
+		"<member><name>Int</name><value><string> 42 </string></value></member>" +
+		"<member><name>Uint</name><value>7</value></member>" +
+		"<member><name>Float</name><value><string>1.5</string></value></member>" +
+		"<member><name>Ratio</name><value><i4>3</i4></value></member>" +
+		"<member><name>Flag</name><value><int>1</int></value></member>" +
+		"<member><name>Tags</name><value>one</value></member>" +
+		"<member><name>Counts</name><value><string>5</string></value></member>" +
+		"<member><name>Data</name><value><base64>aGk=</base64></value></member>" +
+		"</struct></value>"
+
+	var lenient CoercionStruct
+	if err := NewDecoder(strings.NewReader(value)).Decode(&lenient); err == nil {
+		t.Error("expected a type mismatch without coercion")
+	}
+
+	var got CoercionStruct
+	decoder := NewDecoder(strings.NewReader(value))
+	decoder.SetCoercion(CoerceAll)
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatal("Decode failed", err)
+	}
+	expected := CoercionStruct{
+		Int:    42,
+		Uint:   7,
+		Float:  1.5,
+		Ratio:  3,
+		Flag:   true,
+		Tags:   []string{"one"},
+		Counts: []int{5},
+		Data:   []byte("hi"),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	tests := []struct {
+		coercion Coercion
+		value    string
+		target   interface{}
+		err      string
+	}{
+		{CoerceIntToBool, "<int>2</int>", new(bool), "2 isn't a boolean"},
+		{CoerceNumericStrings, "<string>abc</string>", new(int), `invalid syntax`},
+		{CoerceNumericStrings, "<string>300</string>", new(uint8), "out of range"},
+		{CoerceNumericStrings, "<int>1</int>", new(float64), "type mismatch"},
+		{CoerceIntToFloat, "<string>1</string>", new(float64), "type mismatch"},
+		{CoerceScalarToSlice, "<string>a</string>", new([]int), "at value[0]"},
+		{CoerceAll, "<struct></struct>", new([]int), "mismatch"},
+	}
+	for _, test := range tests {
+		decoder := NewDecoder(strings.NewReader("<value>" + test.value + "</value>"))
+		decoder.SetCoercion(test.coercion)
+		err := decoder.Decode(test.target)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.value, test.err, err)
+		}
+	}
+}
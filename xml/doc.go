@@ -14,28 +14,115 @@
 
 // The main objective was to use standard encoding/xml package for XML marshalling/unmarshalling. Unfortunately, in current implementation there is no graceful way to implement common structre for marshal and unmarshal functions - marshalling doesn't handle interface{} types so far (though, it could be changed in the future). So, marshalling is implemented manually.
 
-// Unmarshalling code first creates temporary structure for unmarshalling XML into, then converts it into the passed variable using reflect package. If XML struct member's name is lowercased, it's first letter will be uppercased, as in Go/Gorilla field name must be exported(first-letter uppercased).
+// Unmarshalling code first creates temporary structure for unmarshalling XML into, then converts it into the passed variable using reflect package. The temporary structure is built token by token while the input is read, and marshalling writes straight to the output, so Encoder and Decoder can be used on streams without holding the raw document in memory. If XML struct member's name is lowercased, it's first letter will be uppercased, as in Go/Gorilla field name must be exported(first-letter uppercased).
 
 // Marshalling code converts rpc directly to the string XML representation.
 
 // For the better understanding, I use terms 'rpc2xml' and 'xml2rpc' instead of 'marshal' and 'unmarshall'.
 
+// The same conversions are exported as Marshal and Unmarshal for a single <value>, and as MarshalRequest, UnmarshalRequest, MarshalResponse and UnmarshalResponse for a whole methodCall or methodResponse.
+
 // Types
 
 // The following types are supported:
 
 //     XML-RPC             Golang
 //     -------             ------
-//     int, i4             int
-//     double              float64
+//     int, i4             int, int8-int32, uint8-uint16
+//     i8                  int64, uint, uint32, uint64 (int too, when out of 32-bit range)
+//     double              float64, float32
 //     boolean             bool
 //     stringi             string
 //     dateTime.iso8601    time.Time
-//     base64              []byte
-//     struct              struct
+//     base64              []byte, [N]byte
+//     struct              struct, map[string]T
 //     array               []interface{}
 //     nil                 nil
 
+// Any value can also be decoded into an interface{}, where it's stored as the natural Go type of its XML-RPC type: int, int64 (for i8), float64, bool, string, time.Time, []byte, map[string]interface{} for a struct, []interface{} for an array and nil.
+
+// Pointers are encoded as the value they point to, and nil pointers and interfaces as <nil/>. Nil slices and maps are encoded as empty arrays and structs, or as <nil/> after Encoder.SetNilPolicy(NilAsNil). When decoding, <nil/> sets pointers, slices, maps and interfaces to nil, and any other value is decoded into the value a pointer points to, allocating it if the pointer is nil. An array replaces the content of a slice, including with an empty one, and must have the length of a Go array it's decoded into.
+
+// Maps are encoded as structs, with their members sorted by key. Map keys must be strings or implement encoding.TextMarshaler.
+
+// Decoding fails with a DecodeError, which locates the value by param index and member and array path, e.g. params[1].items[3].owner, and gives its XML-RPC type and text, the Go type it was decoded into and the underlying error. For malformed input, it gives the line and column of the syntax error instead. A server doesn't call the method of a request it can't decode. Server sends the DecodeError as the fault of the underlying error, FaultInvalidParams or FaultDecode, followed by the location; through gorilla/rpc, which answers a request it can't read with a 400 Bad Request status, the error message is sent as text.
+
+// Values of any other type, such as channels, functions and complex numbers, can't be encoded: encoding stops with an UnsupportedTypeError naming the type and the path of the value, e.g. Args.Items[3].Owner. A server replies with a fault when its response can't be encoded.
+
+// Strings, struct member names and method names are escaped. Text holding a character XML 1.0 doesn't allow, such as a control character or invalid UTF-8, stops encoding with an InvalidCharError, unless Encoder.SetInvalidCharPolicy selects ReplaceInvalidChars, which replaces it with U+FFFD, or StripInvalidChars, which drops it. Faults are always sent with such characters replaced.
+
+// Types implementing Marshaler and Unmarshaler choose their own representation: MarshalXMLRPC returns the value to encode instead, and UnmarshalXMLRPC is passed a function decoding into any Go value. Otherwise, types implementing encoding.TextMarshaler and encoding.TextUnmarshaler are sent as <string>. Passed as the args of a call, a struct implementing any of them is a single param, rather than a param per field, as are time.Time, big.Int and big.Float.
+
+// Floats are encoded with the fewest digits that decode back to the same value, without exponent, e.g. 0.000000001 for 1e-9. NaN and infinities have no XML-RPC representation: encoding stops with an UnsupportedValueError, unless Encoder.SetNonFinitePolicy selects NonFiniteAsNil or NonFiniteAsText, which sends NaN, Infinity and -Infinity.
+
+// Times are encoded with DateTimeLayout, 20060102T15:04:05, in UTC, so that they don't depend on the time zone of either peer; Encoder.SetTimeLayout and Encoder.SetTimeLocation change both. Decoding accepts the common ISO 8601 variants, with dashes, fractional seconds and a Z or ±hh:mm offset, which the decoded time keeps. Times without offset are decoded in UTC, or the location set with Decoder.SetTimeLocation. Codec, Server and Client have the same SetTimeLayout and SetTimeLocation, the location applying to both the times they send and those they decode.
+
+// Integers are encoded by kind: int64, uint, uint32 and uint64 as <i8>, as used by Apache XML-RPC, and the smaller kinds as <int>. An int is encoded as <int> when it fits in 32 bits and as <i8> otherwise. When decoding, <int>, <i4> and <i8> fit any Go integer kind and <double> any float kind, as long as the value is in range.
+
+// Encoder.SetExtensions and Decoder.SetExtensions enable the Apache XML-RPC extension types, in the ExtensionsNamespace namespace: nil is sent as <ex:nil/>, int8, int16 and float32 as <ex:i1>, <ex:i2> and <ex:float>, and *big.Int and *big.Float as <ex:biginteger> and <ex:bigdecimal>. <ex:dateTime> is decoded as time.Time. Decoded into an interface{}, the extension types keep their Go type. Codec.SetExtensions, Server.SetExtensions and Client.SetExtensions enable them on both the requests and the responses.
+
+// Struct members
+
+// Struct fields are encoded as members named after the field. The `xmlrpc` struct tag changes the name and accepts the following options, on both the encode and decode paths:
+
+//     Name  string `xmlrpc:"name"`           // encoded as the "name" member
+//     Note  string `xmlrpc:"note,omitempty"` // left out when empty
+//     Owner *User  `xmlrpc:"owner,nil"`      // a zero value is encoded as <nil/>, <nil/> decoded as zero
+//     ID    int    `xmlrpc:"id,required"`    // must be present when decoding strictly
+//     Cache []byte `xmlrpc:"-"`              // never encoded nor decoded
+
+// A field without `xmlrpc` tag uses the name of its `xml` tag. When decoding, members which match no name exactly are matched against the names of untagged fields, with the first letter uppercased and underscores removed, then case insensitively. A tagged field only matches its tag, and the fields of embedded structs only match as members of the embedded struct.
+
+// Members matching no field are ignored when decoding, and a duplicate member overrides the previous one. Decoder.SetStrict, Codec.SetStrict and Client.SetStrict reject both instead, as well as structs missing members, or requests missing params, for fields tagged required.
+
+// A value whose type doesn't match its field fails to decode. Decoder.SetCoercion, Codec.SetCoercion and Client.SetCoercion allow a few conversions for sloppy peers, all disabled by default: CoerceNumericStrings decodes a string holding a number into a number, CoerceIntToFloat an int into a float, CoerceIntToBool an int of 0 or 1 into a bool, and CoerceScalarToSlice a single value into a one-element slice. CoerceAll enables them all.
+
+// Standalone server
+
+// Server is an http.Handler serving XML-RPC without rpc.Server. It answers every POST request as XML-RPC, whatever its Content-Type. It registers services like gorilla/rpc, and plain funcs taking a context:
+
+//     s := xml.NewServer()
+//     s.RegisterService(new(HelloService), "")
+//     s.RegisterFunc("Math.Add", func(ctx context.Context, args *AddArgs) (int, error) {
+//         return args.A + args.B, nil
+//     })
+//     s.EnableIntrospection()
+//     http.Handle("/RPC2", s)
+
+// Server.Codec returns its codec, to set aliases, a method mapper, strict decoding or coercion.
+
+// net/rpc
+
+// NewClientCodec and NewServerCodec implement the net/rpc ClientCodec and ServerCodec over any connection, each message being framed as an HTTP/1.1 request or response. A client can talk to a Server or any XML-RPC server keeping its connection alive:
+
+//     conn, _ := net.Dial("tcp", "localhost:1234")
+//     client := rpc.NewClientWithCodec(xml.NewClientCodec(conn))
+//     err := client.Call("Arith.Multiply", &Args{4, 2}, &reply)
+
+// and net/rpc services can be served with server.ServeCodec(xml.NewServerCodec(conn)). A fault is reported to the client as an rpc.ServerError holding its code and message.
+
+// Introspection
+
+// Services registered through Codec.RegisterService are recorded by the codec, so that Codec.EnableIntrospection can expose them with the standard system.listMethods, system.methodSignature and system.methodHelp methods. Signatures are derived from the Go args and reply types, help text is set with the MethodHelp option:
+
+//     codec := xml.NewCodec()
+//     RPC.RegisterCodec(codec, "text/xml")
+//     codec.RegisterService(RPC, new(HelloService), "", xml.MethodHelp("Say", "Greets the caller."))
+//     codec.EnableIntrospection(RPC)
+
+// Codec.EnableMulticall adds system.multicall, which runs a batch of calls against the services registered through the codec and replies with an array holding either a one-element array with the result or a fault struct for each call.
+
+// Method names
+
+// Codec.RegisterAlias maps a single method name to a registered one. Codec.SetMethodMapper maps any other name, such as the blogger.getUsersBlogs or lowercase service.method sent by some clients, to the Service.Method expected by gorilla/rpc. SnakeToCamel, RewritePrefix and Codec.CaseInsensitive are provided, and ChainMappers combines them:
+
+//     codec.SetMethodMapper(xml.ChainMappers(
+//         xml.RewritePrefix("blogger.", "Blog."),
+//         xml.SnakeToCamel,
+//     ))
+
+// Aliases and the mapper may be changed while the codec serves requests.
+
 // TODO
 
 // TODO list:
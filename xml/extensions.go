@@ -0,0 +1,160 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// ExtensionsNamespace is the namespace of the Apache XML-RPC extension
+// types, sent by Apache XML-RPC peers with enabledForExtensions set.
+const ExtensionsNamespace = "http://ws.apache.org/xmlrpc/namespaces/extensions"
+
+// The extension types, as value types are named once decoded.
+var extensionTypes = map[string]bool{
+	"ex:nil":        true,
+	"ex:i1":         true,
+	"ex:i2":         true,
+	"ex:i8":         true,
+	"ex:float":      true,
+	"ex:dateTime":   true,
+	"ex:bigdecimal": true,
+	"ex:biginteger": true,
+}
+
+var (
+	typeOfBigInt   = reflect.TypeOf((*big.Int)(nil))
+	typeOfBigFloat = reflect.TypeOf((*big.Float)(nil))
+)
+
+// ----------------------------------------------------------------------------
+// Encoder
+// ----------------------------------------------------------------------------
+
+// SetExtensions enables the Apache XML-RPC extension types. The encoder then
+// sends nil as <ex:nil/>, int8 and int16 as <ex:i1> and <ex:i2>, the
+// integers otherwise sent as <i8> as <ex:i8>, float32 as <ex:float>, and *big.Int and
+// *big.Float as <ex:biginteger> and <ex:bigdecimal>.
+func (e *Encoder) SetExtensions(enabled bool) {
+	e.extensions = enabled
+}
+
+// namespaces returns the namespace declarations of a root element.
+func (e *Encoder) namespaces() string {
+	if e.extensions {
+		return ` xmlns:ex="` + ExtensionsNamespace + `"`
+	}
+	return ""
+}
+
+func (e *Encoder) nil2XML() string {
+	if e.extensions {
+		return "<ex:nil/>"
+	}
+	return "<nil/>"
+}
+
+// big2XML encodes a *big.Int or *big.Float, and reports whether value is
+// one of them.
+func (e *Encoder) big2XML(value interface{}) (bool, error) {
+	var elem, text string
+	switch v := value.(type) {
+	case *big.Int:
+		if v == nil {
+			return false, nil
+		}
+		elem, text = "ex:biginteger", v.String()
+	case *big.Float:
+		if v == nil {
+			return false, nil
+		}
+		if v.IsInf() {
+			return true, &UnsupportedValueError{Value: reflect.ValueOf(v), Str: v.String()}
+		}
+		elem, text = "ex:bigdecimal", v.Text('f', -1)
+	default:
+		return false, nil
+	}
+	e.startValue()
+	fmt.Fprintf(e.w, "<%s>%s</%[1]s>", elem, text)
+	e.w.WriteString("</value>")
+	return true, nil
+}
+
+// ----------------------------------------------------------------------------
+// Decoder
+// ----------------------------------------------------------------------------
+
+// SetExtensions enables the Apache XML-RPC extension types. The decoder then
+// accepts <ex:i1>, <ex:i2> and <ex:float> for any integer or float kind,
+// <ex:dateTime> for time.Time, and <ex:biginteger> and <ex:bigdecimal> for
+// *big.Int and *big.Float, or any integer or float kind the value fits.
+//
+// <ex:nil/> and <ex:i8> are accepted even when the extensions are disabled,
+// as they're the same as the common <nil/> and <i8>.
+func (d *Decoder) SetExtensions(enabled bool) {
+	d.extensions = enabled
+}
+
+// isExtension reports whether an element of the name space is an extension
+// type. An undeclared ex prefix is taken as the extensions namespace.
+func isExtension(space string) bool {
+	return space == ExtensionsNamespace || space == "ex"
+}
+
+// checkExtension returns an error if typ is an extension type the decoder
+// doesn't accept.
+func (d *Decoder) checkExtension(typ string) error {
+	if !strings.HasPrefix(typ, "ex:") || typ == "ex:nil" || typ == "ex:i8" {
+		return nil
+	}
+	if d.extensions && extensionTypes[typ] {
+		return nil
+	}
+	fault := FaultInvalidParams
+	fault.String += fmt.Sprintf(": unsupported type <%s>", typ)
+	return fault
+}
+
+// bigInt2Field stores the text of an <ex:biginteger> into a *big.Int field,
+// or a field of any integer kind, checking it fits.
+func bigInt2Field(text string, field *reflect.Value) error {
+	i, ok := new(big.Int).SetString(strings.TrimSpace(text), 10)
+	if !ok {
+		return fmt.Errorf("xml: invalid <ex:biginteger> %q", text)
+	}
+	if field.Type() == typeOfBigInt {
+		field.Set(reflect.ValueOf(i))
+		return nil
+	}
+	if !i.IsInt64() {
+		return outOfRange(i, field.Type())
+	}
+	return int2Field(i.Int64(), field)
+}
+
+// bigFloat2Field stores the text of an <ex:bigdecimal> into a *big.Float
+// field, or a field of any float kind. The precision of the *big.Float is
+// enough to hold every digit of the text.
+func bigFloat2Field(text string, field *reflect.Value) error {
+	text = strings.TrimSpace(text)
+	prec := uint(64)
+	if p := uint(len(text)) * 4; p > prec {
+		prec = p
+	}
+	f, _, err := big.ParseFloat(text, 10, prec, big.ToNearestEven)
+	if err != nil {
+		return fmt.Errorf("xml: invalid <ex:bigdecimal> %q", text)
+	}
+	if field.Type() == typeOfBigFloat {
+		field.Set(reflect.ValueOf(f))
+		return nil
+	}
+	f64, _ := f.Float64()
+	return float2Field(f64, field)
+}
@@ -0,0 +1,212 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ExtensionsStruct struct {
+	I1      int8
+	I2      int16
+	I8      int64
+	Float   float32
+	Int     *big.Int
+	Decimal *big.Float
+	None    *big.Int
+}
+
+func TestEncodeExtensions(t *testing.T) {
+	decimal, _, _ := big.ParseFloat("12345678901234567890.125", 10, 128, big.ToNearestEven)
+	args := ExtensionsStruct{
+		I1:      -8,
+		I2:      1600,
+		I8:      1 << 40,
+		Float:   1.5,
+		Int:     new(big.Int).Lsh(big.NewInt(1), 70),
+		Decimal: decimal,
+	}
+
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.SetExtensions(true)
+	if err := encoder.EncodeRequest("Some.Method", args); err != nil {
+		t.Error("EncodeRequest failed", err)
+	}
+	expected := `<methodCall xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions"><methodName>Some.Method</methodName><params>` +
+		"<param><value><ex:i1>-8</ex:i1></value></param>" +
+		"<param><value><ex:i2>1600</ex:i2></value></param>" +
+		"<param><value><ex:i8>1099511627776</ex:i8></value></param>" +
+		"<param><value><ex:float>1.5</ex:float></value></param>" +
+		"<param><value><ex:biginteger>1180591620717411303424</ex:biginteger></value></param>" +
+		"<param><value><ex:bigdecimal>12345678901234567890.125</ex:bigdecimal></value></param>" +
+		"<param><value><ex:nil/></value></param>" +
+		"</params></methodCall>"
+	if buffer.String() != expected {
+		t.Error("Expected", expected)
+		t.Error("Got", buffer.String())
+	}
+
+	decoder := NewDecoder(&buffer)
+	decoder.SetExtensions(true)
+	var got ExtensionsStruct
+	if _, err := decoder.DecodeRequest(&got); err != nil {
+		t.Error("DecodeRequest failed", err)
+	}
+	if got.I1 != args.I1 || got.I2 != args.I2 || got.I8 != args.I8 || got.Float != args.Float {
+		t.Errorf("Expected %v, got %v", args, got)
+	}
+	if got.Int.Cmp(args.Int) != 0 || got.Decimal.Cmp(args.Decimal) != 0 || got.None != nil {
+		t.Errorf("Expected %v %v <nil>, got %v %v %v", args.Int, args.Decimal, got.Int, got.Decimal, got.None)
+	}
+
+	buffer.Reset()
+	if err := encoder.Encode((*big.Int)(nil)); err != nil {
+		t.Error("Encode failed", err)
+	}
+	expected = `<value xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions"><ex:nil/></value>`
+	if buffer.String() != expected {
+		t.Error("Expected", expected)
+		t.Error("Got", buffer.String())
+	}
+}
+
+func TestEncodeExtensionsInf(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.SetExtensions(true)
+	err := encoder.Encode(map[string]interface{}{"d": new(big.Float).SetInf(false)})
+	uve, ok := err.(*UnsupportedValueError)
+	if !ok {
+		t.Fatal("expected error to be of concrete type UnsupportedValueError, but got", err)
+	}
+	if uve.Str != "+Inf" || uve.Path != `["d"]` {
+		t.Errorf("expected +Inf at [\"d\"], got %s at %s", uve.Str, uve.Path)
+	}
+}
+
+func TestDecodeExtensions(t *testing.T) {
+	response := `<methodResponse xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions"><params><param><value><struct>` +
+		"<member><name>i1</name><value><ex:i1>1</ex:i1></value></member>" +
+		"<member><name>i2</name><value><ex:i2>2</ex:i2></value></member>" +
+		"<member><name>i8</name><value><ex:i8>8</ex:i8></value></member>" +
+		"<member><name>float</name><value><ex:float>0.5</ex:float></value></member>" +
+		"<member><name>date</name><value><ex:dateTime>2024-01-02T03:04:05.000Z</ex:dateTime></value></member>" +
+		"<member><name>int</name><value><ex:biginteger>42</ex:biginteger></value></member>" +
+		"<member><name>decimal</name><value><ex:bigdecimal>0.25</ex:bigdecimal></value></member>" +
+		"<member><name>none</name><value><ex:nil/></value></member>" +
+		"</struct></value></param></params></methodResponse>"
+
+	decoder := NewDecoder(strings.NewReader(response))
+	decoder.SetExtensions(true)
+	var got map[string]interface{}
+	if err := decoder.DecodeResponse(&got); err != nil {
+		t.Fatal("DecodeResponse failed", err)
+	}
+	expected := map[string]interface{}{
+		"i1":      int8(1),
+		"i2":      int16(2),
+		"i8":      int64(8),
+		"float":   float32(0.5),
+		"date":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"int":     big.NewInt(42),
+		"decimal": got["decimal"],
+		"none":    nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Error("Expected", expected)
+		t.Error("Got", got)
+	}
+	if f, _ := got["decimal"].(*big.Float).Float64(); f != 0.25 {
+		t.Error("Wrong decimal:", got["decimal"])
+	}
+
+	var values struct {
+		Int     int
+		Decimal float64
+		Big     big.Int
+	}
+	decoder = NewDecoder(strings.NewReader("<methodResponse><params>" +
+		"<param><value><ex:biginteger>42</ex:biginteger></value></param>" +
+		"<param><value><ex:bigdecimal>0.25</ex:bigdecimal></value></param>" +
+		"<param><value><ex:biginteger>1180591620717411303424</ex:biginteger></value></param>" +
+		"</params></methodResponse>"))
+	decoder.SetExtensions(true)
+	if err := decoder.DecodeResponse(&values); err != nil {
+		t.Error("DecodeResponse failed", err)
+	}
+	if values.Int != 42 || values.Decimal != 0.25 || values.Big.String() != "1180591620717411303424" {
+		t.Error("Wrong values:", values.Int, values.Decimal, values.Big.String())
+	}
+
+	var small int8
+	err := xml2RPC("<methodResponse><params><param><value><ex:i1>1</ex:i1></value></param></params></methodResponse>", &small)
+	if de, ok := err.(*DecodeError); !ok || toFault(de).Code != FaultInvalidParams.Code {
+		t.Errorf("expected FaultInvalidParams without extensions, got %v", err)
+	}
+	var i8 int64
+	var none *int
+	err = xml2RPC("<methodResponse><params><param><value><ex:i8>8</ex:i8></value></param></params></methodResponse>", &i8)
+	if err != nil || i8 != 8 {
+		t.Error("<ex:i8> should be decoded without extensions", i8, err)
+	}
+	err = xml2RPC("<methodResponse><params><param><value><ex:nil/></value></param></params></methodResponse>", &none)
+	if err != nil || none != nil {
+		t.Error("<ex:nil/> should be decoded without extensions", none, err)
+	}
+}
+
+func TestExtensionsClientServer(t *testing.T) {
+	s := NewServer()
+	s.SetExtensions(true)
+	if err := s.RegisterFunc("Math.Half", func(ctx context.Context, n int16) (int8, error) {
+		return int8(n / 2), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var request, response string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request = string(body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, r)
+		response = rec.Body.String()
+		w.Header().Set("Content-Type", rec.Header().Get("Content-Type"))
+		w.Write(rec.Body.Bytes())
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, nil)
+	client.SetExtensions(true)
+	var half int8
+	if err := client.Call(context.Background(), "Math.Half", int16(84), &half); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if half != 42 {
+		t.Errorf("Wrong response: %v.", half)
+	}
+	if !strings.Contains(request, "<ex:i2>84</ex:i2>") {
+		t.Error("request without extensions:", request)
+	}
+	if !strings.Contains(response, "<ex:i1>42</ex:i1>") {
+		t.Error("response without extensions:", response)
+	}
+
+	// Without the extensions, the client rejects the response.
+	client.SetExtensions(false)
+	if err := client.Call(context.Background(), "Math.Half", int16(84), &half); err == nil {
+		t.Error("Expected an error decoding <ex:i1> without extensions")
+	}
+}
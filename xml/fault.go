@@ -13,6 +13,7 @@ import (
 // NOTE: XMLRPC spec doesn't specify any Fault codes.
 // These codes seems to be widely accepted, and taken from the http://xmlrpc-epi.sourceforge.net/specs/rfc.fault_codes.php
 var (
+	FaultMethodNotFound       = Fault{Code: -32601, String: "Requested Method Not Found"}
 	FaultInvalidParams        = Fault{Code: -32602, String: "Invalid Method Parameters"}
 	FaultWrongArgumentsNumber = Fault{Code: -32602, String: "Wrong Arguments Number"}
 	FaultInternalError        = Fault{Code: -32603, String: "Internal Server Error"}
@@ -32,12 +33,27 @@ func (f Fault) Error() string {
 	return fmt.Sprintf("%d: %s", f.Code, f.String)
 }
 
+// toFault converts err to a Fault: a Fault is returned as is, a DecodeError
+// becomes the fault of its underlying error, any other error becomes
+// FaultApplicationError with the error message.
+func toFault(err error) Fault {
+	switch e := err.(type) {
+	case Fault:
+		return e
+	case *DecodeError:
+		return e.fault()
+	}
+	fault := FaultApplicationError
+	fault.String += fmt.Sprintf(": %v", err)
+	return fault
+}
+
 // Fault2XML is a quick 'marshalling' replacemnt for the Fault case.
 func fault2XML(fault Fault) string {
 	buffer := new(strings.Builder)
-	buffer.WriteString("<methodResponse><fault>")
-	rpc2XML(buffer, fault)
-	buffer.WriteString("</fault></methodResponse>")
+	encoder := NewEncoder(buffer)
+	encoder.SetInvalidCharPolicy(ReplaceInvalidChars)
+	encoder.EncodeFault(fault)
 	return buffer.String()
 }
 
@@ -5,7 +5,9 @@
 package xml
 
 import (
+	"errors"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -42,6 +44,31 @@ func (t *FaultTest) Multiply(r *http.Request, req *FaultTestRequest, res *FaultT
 	return nil
 }
 
+func (t *FaultTest) Divide(r *http.Request, req *FaultTestRequest, res *FaultTestResponse) error {
+	if req.B == 0 {
+		return errors.New("division by zero")
+	}
+	res.Result = req.A / req.B
+	return nil
+}
+
+func (t *FaultTest) Fail(r *http.Request, req *FaultTestRequest, res *FaultTestResponse) error {
+	return Fault{Code: req.A, String: "custom fault"}
+}
+
+func (t *FaultTest) Control(r *http.Request, req *FaultTestRequest, res *FaultTestResponse) error {
+	return errors.New("bad \x01 input")
+}
+
+type FaultTestChanResponse struct {
+	Result chan int
+}
+
+func (t *FaultTest) Chan(r *http.Request, req *FaultTestRequest, res *FaultTestChanResponse) error {
+	res.Result = make(chan int)
+	return nil
+}
+
 func TestFaults(t *testing.T) {
 	s := rpc.NewServer()
 	s.RegisterCodec(NewCodec(), "text/xml")
@@ -49,36 +76,100 @@ func TestFaults(t *testing.T) {
 
 	var err error
 
-	var res1 FaultTestResponse
-	err = execute(t, s, "FaultTest.Multiply", &FaultTestBadRequest{4, 2, 4}, &res1)
+	// gorilla/rpc answers params the method can't take with a 400 Bad
+	// Request status.
+	buf, _ := EncodeClientRequest("FaultTest.Multiply", &FaultTestBadRequest{4, 2, 4})
+	w := post(s, string(buf))
+	if w.Code != http.StatusBadRequest || w.Body.String() != "-32602: Wrong Arguments Number" {
+		t.Errorf("wrong response: %d %s", w.Code, w.Body.String())
+	}
+
+	var res2 FaultTestBadResponse
+	err = execute(t, s, "FaultTest.Multiply", &FaultTestRequest{4, 2}, &res2)
 	if err == nil {
 		t.Fatal("expected err to be not nil, but got:", err)
 	}
+	// The reply is decoded by the client, which reports the mismatch as a
+	// DecodeError wrapping the fault.
+	decodeErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatal("expected error to be of concrete type *DecodeError, but got", err)
+	}
+	if decodeErr.Param != 0 || decodeErr.Path != "" || decodeErr.Type != "int" || decodeErr.GoType.Kind() != reflect.String {
+		t.Errorf("wrong error location: %v", decodeErr)
+	}
+	fault, ok := decodeErr.Err.(Fault)
+	if !ok {
+		t.Fatal("expected error to wrap a Fault, but got", decodeErr.Err)
+	}
+	if fault.Code != -32602 {
+		t.Errorf("wrong fault code: %d", fault.Code)
+	}
+
+	if !strings.HasPrefix(fault.String, "Invalid Method Parameters: fields type mismatch") {
+		t.Errorf("wrong response: %s", fault.String)
+	}
+}
+
+func TestMethodErrorFaults(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "text/xml")
+	s.RegisterService(new(FaultTest), "")
+
+	var res FaultTestResponse
+	err := execute(t, s, "FaultTest.Divide", &FaultTestRequest{4, 0}, &res)
 	fault, ok := err.(Fault)
 	if !ok {
 		t.Fatal("expected error to be of concrete type Fault, but got", err)
 	}
-	if fault.Code != -32602 {
+	if fault.Code != FaultApplicationError.Code {
 		t.Errorf("wrong fault code: %d", fault.Code)
 	}
-	if fault.String != "Wrong Arguments Number" {
+	if fault.String != "Application Error: division by zero" {
 		t.Errorf("wrong fault string: %s", fault.String)
 	}
 
-	var res2 FaultTestBadResponse
-	err = execute(t, s, "FaultTest.Multiply", &FaultTestRequest{4, 2}, &res2)
-	if err == nil {
-		t.Fatal("expected err to be not nil, but got:", err)
-	}
+	err = execute(t, s, "FaultTest.Fail", &FaultTestRequest{42, 0}, &res)
 	fault, ok = err.(Fault)
 	if !ok {
 		t.Fatal("expected error to be of concrete type Fault, but got", err)
 	}
-	if fault.Code != -32602 {
+	if fault.Code != 42 || fault.String != "custom fault" {
+		t.Errorf("wrong fault: %v", fault)
+	}
+}
+
+func TestEncodingErrorFaults(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "text/xml")
+	s.RegisterService(new(FaultTest), "")
+
+	var res FaultTestResponse
+	err := execute(t, s, "FaultTest.Chan", &FaultTestRequest{4, 2}, &res)
+	fault, ok := err.(Fault)
+	if !ok {
+		t.Fatal("expected error to be of concrete type Fault, but got", err)
+	}
+	if fault.Code != FaultApplicationError.Code {
 		t.Errorf("wrong fault code: %d", fault.Code)
 	}
+	if fault.String != "Application Error: xml: unsupported type chan int at FaultTestChanResponse.Result" {
+		t.Errorf("wrong fault string: %s", fault.String)
+	}
+}
 
-	if !strings.HasPrefix(fault.String, "Invalid Method Parameters: fields type mismatch") {
-		t.Errorf("wrong response: %s", fault.String)
+func TestInvalidCharFaults(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "text/xml")
+	s.RegisterService(new(FaultTest), "")
+
+	var res FaultTestResponse
+	err := execute(t, s, "FaultTest.Control", &FaultTestRequest{4, 2}, &res)
+	fault, ok := err.(Fault)
+	if !ok {
+		t.Fatal("expected error to be of concrete type Fault, but got", err)
+	}
+	if fault.String != "Application Error: bad \uFFFD input" {
+		t.Errorf("wrong fault string: %q", fault.String)
 	}
 }
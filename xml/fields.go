@@ -0,0 +1,144 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldInfo describes how a struct field maps to a struct member.
+//
+// The member name and options come from the `xmlrpc` tag, e.g.
+//
+//     Name  string `xmlrpc:"name,omitempty"`
+//     Owner *User  `xmlrpc:"owner,nil"`
+//     ID    int    `xmlrpc:"id,required"`
+//     Cache []byte `xmlrpc:"-"`
+//
+// A field without `xmlrpc` tag falls back to the name of its `xml` tag, and
+// then to the field name.
+type fieldInfo struct {
+	index     []int
+	name      string
+	tagged    bool // name comes from a tag
+	skip      bool // tagged "-"
+	omitEmpty bool // an empty value isn't encoded
+	nilZero   bool // a zero value is encoded as <nil/>, and <nil/> decoded as zero
+	required  bool // a strict Decoder rejects a struct without this member
+}
+
+// newFieldInfo parses the tags of sf.
+func newFieldInfo(sf reflect.StructField) fieldInfo {
+	fi := fieldInfo{index: sf.Index, name: sf.Name}
+	tag, ok := sf.Tag.Lookup("xmlrpc")
+	if !ok {
+		if name := strings.Split(sf.Tag.Get("xml"), ",")[0]; name != "" {
+			fi.name, fi.tagged = name, true
+		}
+		return fi
+	}
+	if tag == "-" {
+		fi.skip = true
+		return fi
+	}
+
+	opts := strings.Split(tag, ",")
+	if opts[0] != "" {
+		fi.name, fi.tagged = opts[0], true
+	}
+	for _, opt := range opts[1:] {
+		switch opt {
+		case "omitempty":
+			fi.omitEmpty = true
+		case "nil":
+			fi.nilZero = true
+		case "required":
+			fi.required = true
+		}
+	}
+	return fi
+}
+
+// structFields returns the fields of struct type t encoded as members.
+func structFields(t reflect.Type) []fieldInfo {
+	fields := make([]fieldInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		if fi := newFieldInfo(sf); !fi.skip {
+			fields = append(fields, fi)
+		}
+	}
+	return fields
+}
+
+// fieldByMember returns the field of struct type t the member called name
+// is decoded into.
+//
+// Names are matched exactly. The names of untagged fields are then matched
+// with the first letter of name uppercased and underscores removed, then
+// case insensitively. Only the fields of t itself match, not those promoted
+// from embedded structs, which are encoded as members of their own.
+func fieldByMember(t reflect.Type, name string) (fieldInfo, bool) {
+	fields := structFields(t)
+	for _, fi := range fields {
+		if fi.name == name {
+			return fi, true
+		}
+	}
+
+	// Uppercase first letter for field name to deal with
+	// methods in lowercase, which cannot be used
+	caption := captionString(name)
+	for _, fi := range fields {
+		if !fi.tagged && fi.name == caption {
+			return fi, true
+		}
+	}
+	var match *fieldInfo
+	for i, fi := range fields {
+		if !fi.tagged && strings.EqualFold(fi.name, name) {
+			if match != nil {
+				return fieldInfo{}, false
+			}
+			match = &fields[i]
+		}
+	}
+	if match == nil {
+		return fieldInfo{}, false
+	}
+	return *match, true
+}
+
+// isEmptyValue reports whether v is empty in the sense of the omitempty and
+// nil options: false, 0, a nil pointer or interface, an empty array, slice,
+// map or string, or a struct whose fields are all empty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isEmptyValue(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+var (
+	typeOfContext       = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfMulticallArgs = reflect.TypeOf(multicallArgs{})
+)
+
+// ----------------------------------------------------------------------------
+// Server
+// ----------------------------------------------------------------------------
+
+// NewServer returns a new standalone XML-RPC Server.
+func NewServer() *Server {
+	return &Server{codec: NewCodec()}
+}
+
+// Server is an http.Handler serving XML-RPC without gorilla/rpc. It answers
+// every POST request as XML-RPC, whatever its Content-Type.
+type Server struct {
+	codec *Codec
+}
+
+// Codec returns the codec the server decodes requests with, to set aliases,
+// a method mapper, strict decoding or coercion. Its services are those of
+// the server.
+func (s *Server) Codec() *Codec {
+	return s.codec
+}
+
+// RegisterService registers the methods of receiver under name, or under
+// the name of its type if name is empty. Methods are registered as by
+// rpc.Server.RegisterService of gorilla/rpc: exported methods of the form
+//
+//     func (*T) Method(r *http.Request, args *Args, reply *Reply) error
+//
+// The options set the help text of the methods, as with
+// Codec.RegisterService.
+func (s *Server) RegisterService(receiver interface{}, name string, opts ...ServiceOption) error {
+	svc, err := newService(receiver, name)
+	if err != nil {
+		return err
+	}
+	if len(svc.methods) == 0 {
+		return fmt.Errorf("xml: %q has no exported methods of suitable type", svc.name)
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	s.codec.mu.Lock()
+	defer s.codec.mu.Unlock()
+	for _, m := range svc.methods {
+		s.codec.methods[m.name] = m
+	}
+	return nil
+}
+
+// RegisterFunc registers fn as the method name, as in "Service.Method". fn
+// must be of the form
+//
+//     func(ctx context.Context, args Args) (Reply, error)
+//
+// where ctx is the context of the HTTP request. A struct Args, or a pointer
+// to one, is decoded from the params as the args of a service method; any
+// other type from a single param. Reply is encoded as the reply of a service
+// method.
+func (s *Server) RegisterFunc(name string, fn interface{}) error {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 ||
+		t.In(0) != typeOfContext || t.Out(1) != typeOfError {
+		return fmt.Errorf("xml: %s: func(context.Context, Args) (Reply, error) expected, got %s", name, t)
+	}
+
+	m := &serviceMethod{
+		name:      name,
+		fn:        f,
+		argsType:  t.In(1),
+		replyType: t.Out(0),
+	}
+	if m.argsType.Kind() == reflect.Ptr {
+		m.argsType, m.argsPtr = m.argsType.Elem(), true
+	}
+	if m.replyType.Kind() == reflect.Ptr {
+		m.replyType = m.replyType.Elem()
+	}
+	s.codec.mu.Lock()
+	defer s.codec.mu.Unlock()
+	s.codec.methods[name] = m
+	return nil
+}
+
+// SetExtensions enables the Apache XML-RPC extension types, see
+// Codec.SetExtensions.
+func (s *Server) SetExtensions(enabled bool) {
+	s.codec.SetExtensions(enabled)
+}
+
+// SetTimeLayout sets the layout of the times of responses, see
+// Codec.SetTimeLayout.
+func (s *Server) SetTimeLayout(layout string) {
+	s.codec.SetTimeLayout(layout)
+}
+
+// SetTimeLocation sets the location of times, see Codec.SetTimeLocation.
+func (s *Server) SetTimeLocation(loc *time.Location) {
+	s.codec.SetTimeLocation(loc)
+}
+
+// EnableIntrospection adds the standard introspection methods, see
+// Codec.EnableIntrospection.
+func (s *Server) EnableIntrospection() error {
+	return s.codec.EnableIntrospection(nil)
+}
+
+// EnableMulticall adds the system.multicall method, see
+// Codec.EnableMulticall.
+func (s *Server) EnableMulticall() error {
+	return s.codec.EnableMulticall(nil)
+}
+
+// ServeHTTP answers an XML-RPC request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "rpc: POST method required, received "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	reply, err := s.serve(r)
+	writeResponse(w, s.codec.newEncoder, reply, err)
+}
+
+// serve decodes the request r and calls its method.
+func (s *Server) serve(r *http.Request) (interface{}, error) {
+	defer r.Body.Close()
+
+	decoder := s.codec.newDecoder(r.Body)
+	ret, err := decoder.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := s.codec.lookupMethod(ret.Method)
+	if !ok {
+		return nil, methodNotFound(ret.Method)
+	}
+
+	args := reflect.New(m.argsType)
+	if m.argsType == typeOfMulticallArgs {
+		calls := args.Interface().(*multicallArgs)
+		calls.Calls, err = decoder.parseMulticall(ret.Params)
+	} else {
+		err = decoder.params2RPC(ret.Params, args.Interface())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.invoke(r, args)
+}
@@ -0,0 +1,201 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStandaloneServer(t *testing.T) *Server {
+	s := NewServer()
+	if err := s.RegisterService(new(Service1), "", MethodHelp("Multiply", "Multiplies A by B.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterFunc("Math.Add", func(ctx context.Context, args Service1Request) (Service1Response, error) {
+		return Service1Response{args.A + args.B}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterFunc("Math.Divide", func(ctx context.Context, args *Service1Request) (*Service1Response, error) {
+		if args.B == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return &Service1Response{args.A / args.B}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterFunc("echo", func(ctx context.Context, text string) (string, error) {
+		return text, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// serve posts a request of method with args to s, with the given
+// Content-Type, and decodes the response into reply.
+func serve(s *Server, contentType, method string, args, reply interface{}) error {
+	buf, _ := EncodeClientRequest(method, args)
+	r, _ := http.NewRequest("POST", "http://localhost:8080/", bytes.NewBuffer(buf))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return DecodeClientResponse(w.Body, reply)
+}
+
+func TestServer(t *testing.T) {
+	s := newStandaloneServer(t)
+
+	for _, contentType := range []string{"text/xml", "application/xml", ""} {
+		var res Service1Response
+		if err := serve(s, contentType, "Service1.Multiply", &Service1Request{4, 2}, &res); err != nil || res.Result != 8 {
+			t.Errorf("%q: wrong response: %v, %v.", contentType, res.Result, err)
+		}
+	}
+
+	var res Service1Response
+	if err := serve(s, "", "Math.Add", &Service1Request{4, 2}, &res); err != nil || res.Result != 6 {
+		t.Errorf("Wrong Math.Add response: %v, %v.", res.Result, err)
+	}
+	if err := serve(s, "", "Math.Divide", &Service1Request{4, 2}, &res); err != nil || res.Result != 2 {
+		t.Errorf("Wrong Math.Divide response: %v, %v.", res.Result, err)
+	}
+	var text string
+	if err := serve(s, "", "echo", "hello", &text); err != nil || text != "hello" {
+		t.Errorf("Wrong echo response: %v, %v.", text, err)
+	}
+
+	tests := []struct {
+		method string
+		args   interface{}
+		fault  string
+	}{
+		{"Math.Divide", &Service1Request{4, 0}, "Application Error: division by zero"},
+		{"Math.Sub", &Service1Request{4, 2}, "Requested Method Not Found: Math.Sub"},
+		{"echo", 42, "Invalid Method Parameters: fields type mismatch: int64 != string at params[0]"},
+		{"echo", map[string]int{"a": 1}, "Invalid Method Parameters: structure fields mismatch: string != struct at params[0]"},
+	}
+	for _, test := range tests {
+		err := serve(s, "", test.method, test.args, &res)
+		if fault, ok := err.(Fault); !ok || fault.String != test.fault {
+			t.Errorf("%s: expected fault %q, got %v", test.method, test.fault, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("expected 405 for GET, got %d", w.Code)
+	}
+}
+
+func TestServerSystemMethods(t *testing.T) {
+	s := newStandaloneServer(t)
+	if err := s.EnableIntrospection(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableMulticall(); err != nil {
+		t.Fatal(err)
+	}
+	s.Codec().SetMethodMapper(s.Codec().CaseInsensitive())
+
+	var methods struct{ Methods []string }
+	if err := serve(s, "", "system.listMethods", &struct{}{}, &methods); err != nil {
+		t.Fatal("system.listMethods failed", err)
+	}
+	expected := []string{
+		"Math.Add",
+		"Math.Divide",
+		"Service1.Multiply",
+		"echo",
+		"system.listMethods",
+		"system.methodHelp",
+		"system.methodSignature",
+		"system.multicall",
+	}
+	if !reflect.DeepEqual(methods.Methods, expected) {
+		t.Errorf("Wrong methods: %v.", methods.Methods)
+	}
+
+	var signatures struct{ Signatures [][]string }
+	if err := serve(s, "", "system.methodSignature", "echo", &signatures); err != nil ||
+		!reflect.DeepEqual(signatures.Signatures, [][]string{{"string", "string"}}) {
+		t.Errorf("Wrong signatures: %v, %v.", signatures.Signatures, err)
+	}
+
+	var multi struct{ Results []interface{} }
+	calls := []interface{}{
+		map[string]interface{}{"methodName": "math.add", "params": []interface{}{3, 2}},
+		map[string]interface{}{"methodName": "Service1.Multiply", "params": []interface{}{5, 2}},
+	}
+	if err := serve(s, "", "system.multicall", calls, &multi); err != nil {
+		t.Fatal("system.multicall failed", err)
+	}
+	if !reflect.DeepEqual(multi.Results, []interface{}{[]interface{}{5}, []interface{}{10}}) {
+		t.Errorf("Wrong results: %v", multi.Results)
+	}
+}
+
+func TestServerRegisterErrors(t *testing.T) {
+	s := NewServer()
+	funcs := []interface{}{
+		42,
+		func(args Service1Request) (Service1Response, error) { return Service1Response{}, nil },
+		func(ctx context.Context, args Service1Request) Service1Response { return Service1Response{} },
+		func(ctx context.Context, args Service1Request) (Service1Response, bool) { return Service1Response{}, true },
+	}
+	for _, fn := range funcs {
+		if err := s.RegisterFunc("Bad.Func", fn); err == nil {
+			t.Errorf("%T: expected an error", fn)
+		}
+	}
+	if err := s.RegisterService(new(struct{}), "Empty"); err == nil {
+		t.Error("expected an error for a service without methods")
+	}
+}
+
+func TestServerTimes(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterFunc("Time.Echo", func(ctx context.Context, tm time.Time) (time.Time, error) {
+		return tm, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	plus2 := time.FixedZone("", 2*60*60)
+	tm := time.Date(2024, time.January, 2, 3, 4, 5, 0, plus2)
+
+	// By default, times are sent in UTC and decoded in UTC.
+	var got time.Time
+	if err := serve(s, "", "Time.Echo", tm, &got); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if !got.Equal(tm) || got.Location() != time.UTC {
+		t.Errorf("Wrong response: %v.", got)
+	}
+
+	// A time without offset is decoded in the location set, and sent back
+	// in it.
+	s.SetTimeLocation(plus2)
+	s.SetTimeLayout("2006-01-02T15:04:05Z07:00")
+	body := "<methodCall><methodName>Time.Echo</methodName><params>" +
+		"<param><value><dateTime.iso8601>20240102T03:04:05</dateTime.iso8601></value></param>" +
+		"</params></methodCall>"
+	r, _ := http.NewRequest("POST", "http://localhost:8080/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "<dateTime.iso8601>2024-01-02T03:04:05+02:00</dateTime.iso8601>") {
+		t.Error("Wrong response:", w.Body.String())
+	}
+}
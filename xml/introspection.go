@@ -0,0 +1,317 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gorilla/rpc"
+)
+
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfRequest = reflect.TypeOf((*http.Request)(nil)).Elem()
+	typeOfTime    = reflect.TypeOf(time.Time{})
+)
+
+// ----------------------------------------------------------------------------
+// Service registry
+// ----------------------------------------------------------------------------
+
+// serviceMethod is a method recorded by the codec: a method of a service, or
+// a func registered with Server.RegisterFunc.
+type serviceMethod struct {
+	name      string // name used by clients, as in "Service.Method"
+	rcvr      reflect.Value
+	method    reflect.Method
+	fn        reflect.Value // set for a func
+	argsPtr   bool          // the func takes a pointer to argsType
+	argsType  reflect.Type
+	replyType reflect.Type
+	help      string
+}
+
+// invoke calls m with args, a pointer to a value of its args type, and
+// returns its reply.
+func (m *serviceMethod) invoke(r *http.Request, args reflect.Value) (interface{}, error) {
+	if m.fn.IsValid() {
+		if !m.argsPtr {
+			args = args.Elem()
+		}
+		out := m.fn.Call([]reflect.Value{reflect.ValueOf(r.Context()), args})
+		err, _ := out[1].Interface().(error)
+		return out[0].Interface(), err
+	}
+	reply := reflect.New(m.replyType)
+	out := m.method.Func.Call([]reflect.Value{m.rcvr, reflect.ValueOf(r), args, reply})
+	err, _ := out[0].Interface().(error)
+	return reply.Interface(), err
+}
+
+// service holds the methods of a receiver being registered.
+type service struct {
+	name    string
+	methods map[string]*serviceMethod // keyed by Go method name
+}
+
+// ServiceOption configures a service registered with Codec.RegisterService.
+type ServiceOption func(s *service)
+
+// MethodHelp sets the text returned by system.methodHelp for method, the Go
+// name of one of the service methods, e.g. "Multiply".
+func MethodHelp(method, help string) ServiceOption {
+	return func(s *service) {
+		if m, ok := s.methods[method]; ok {
+			m.help = help
+		}
+	}
+}
+
+// newService extracts the methods of receiver following the rules of
+// rpc.Server.RegisterService.
+func newService(receiver interface{}, name string) (*service, error) {
+	rcvr := reflect.ValueOf(receiver)
+	if name == "" {
+		name = reflect.Indirect(rcvr).Type().Name()
+	}
+	if name == "" {
+		return nil, fmt.Errorf("xml: no service name for type %q", rcvr.Type())
+	}
+
+	s := &service{
+		name:    name,
+		methods: make(map[string]*serviceMethod),
+	}
+	rcvrType := rcvr.Type()
+	for i := 0; i < rcvrType.NumMethod(); i++ {
+		method := rcvrType.Method(i)
+		mtype := method.Type
+		if method.PkgPath != "" || mtype.NumIn() != 4 || mtype.NumOut() != 1 {
+			continue
+		}
+		if reqType := mtype.In(1); reqType.Kind() != reflect.Ptr || reqType.Elem() != typeOfRequest {
+			continue
+		}
+		args, reply := mtype.In(2), mtype.In(3)
+		if args.Kind() != reflect.Ptr || reply.Kind() != reflect.Ptr || mtype.Out(0) != typeOfError {
+			continue
+		}
+		s.methods[method.Name] = &serviceMethod{
+			name:      name + "." + method.Name,
+			rcvr:      rcvr,
+			method:    method,
+			argsType:  args.Elem(),
+			replyType: reply.Elem(),
+		}
+	}
+	return s, nil
+}
+
+// RegisterService registers receiver on s, exactly like
+// rpc.Server.RegisterService, and records its methods so that they can be
+// described by the introspection methods and called by system.multicall.
+func (c *Codec) RegisterService(s *rpc.Server, receiver interface{}, name string, opts ...ServiceOption) error {
+	if err := s.RegisterService(receiver, name); err != nil {
+		return err
+	}
+	svc, err := newService(receiver, name)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range svc.methods {
+		c.methods[m.name] = m
+	}
+	return nil
+}
+
+// EnableIntrospection registers the standard introspection methods on s:
+//
+//     system.listMethods      lists the methods registered through the codec
+//     system.methodSignature  describes the types of a method's params
+//     system.methodHelp       returns the help text of a method
+//
+// Signatures are derived from the Go args and reply types of each method,
+// using the same type mapping as the rest of the package.
+func (c *Codec) EnableIntrospection(s *rpc.Server) error {
+	if err := c.registerSystem(s, map[string]string{
+		"listMethods":     "Returns the list of methods supported by the server.",
+		"methodSignature": "Returns the list of signatures of the given method.",
+		"methodHelp":      "Returns the help text of the given method.",
+	}); err != nil {
+		return err
+	}
+	c.system.introspection = true
+	return nil
+}
+
+// registerSystem registers the system service on s the first time it's
+// called, and records the given system methods along with their help text.
+// s is nil for the codec of a Server, which calls the recorded methods
+// itself.
+func (c *Codec) registerSystem(s *rpc.Server, help map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.system == nil {
+		system := &systemService{codec: c}
+		if s != nil {
+			if err := s.RegisterService(system, "system"); err != nil {
+				return err
+			}
+		}
+		c.system = system
+	}
+	svc, err := newService(c.system, "system")
+	if err != nil {
+		return err
+	}
+	for name, text := range help {
+		m := svc.methods[captionString(name)]
+		m.name = "system." + name
+		m.help = text
+		c.methods[m.name] = m
+		c.aliases[m.name] = "system." + m.method.Name
+	}
+	return nil
+}
+
+// lookupMethod returns the recorded method called by name.
+func (c *Codec) lookupMethod(name string) (*serviceMethod, bool) {
+	resolved := c.resolve(name)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if m, ok := c.methods[name]; ok {
+		return m, true
+	}
+	m, ok := c.methods[resolved]
+	return m, ok
+}
+
+// signature returns the XML-RPC signature of m: the type of the result
+// followed by the types of the params.
+func (m *serviceMethod) signature() []string {
+	result := "nil"
+	if reply := paramTypes(m.replyType); len(reply) != 0 {
+		result = reply[0]
+	}
+	return append([]string{result}, paramTypes(m.argsType)...)
+}
+
+// paramTypes returns the XML-RPC types of the params t is encoded to.
+func paramTypes(t reflect.Type) []string {
+	if t.Kind() != reflect.Struct || singleParam(t) {
+		return []string{xmlrpcType(t)}
+	}
+	fields := structFields(t)
+	types := make([]string, len(fields))
+	for i, fi := range fields {
+		types[i] = xmlrpcType(t.FieldByIndex(fi.index).Type)
+	}
+	return types
+}
+
+// xmlrpcType returns the name of the XML-RPC type t is encoded to.
+func xmlrpcType(t reflect.Type) string {
+	if t.Implements(typeOfMarshaler) {
+		return "undef"
+	}
+	if t != typeOfTime && t.Implements(typeOfTextMarshaler) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return "int"
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "i8"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Struct:
+		if t == typeOfTime {
+			return "dateTime.iso8601"
+		}
+		return "struct"
+	case reflect.Map:
+		return "struct"
+	case reflect.Slice, reflect.Array:
+		if isBytes(t) {
+			return "base64"
+		}
+		return "array"
+	case reflect.Ptr:
+		return xmlrpcType(t.Elem())
+	}
+	return "undef"
+}
+
+// ----------------------------------------------------------------------------
+// systemService
+// ----------------------------------------------------------------------------
+
+// systemService implements the system.* methods. Each group of methods
+// answers only once it's been enabled on the codec.
+type systemService struct {
+	codec         *Codec
+	introspection bool
+	multicall     bool
+}
+
+// ListMethods implements system.listMethods.
+func (s *systemService) ListMethods(r *http.Request, args *struct{}, reply *struct{ Methods []string }) error {
+	if !s.introspection {
+		return methodNotFound("system.listMethods")
+	}
+	s.codec.mu.RLock()
+	reply.Methods = make([]string, 0, len(s.codec.methods))
+	for name := range s.codec.methods {
+		reply.Methods = append(reply.Methods, name)
+	}
+	s.codec.mu.RUnlock()
+	sort.Strings(reply.Methods)
+	return nil
+}
+
+// MethodSignature implements system.methodSignature.
+func (s *systemService) MethodSignature(r *http.Request, args *struct{ Method string }, reply *struct{ Signatures [][]string }) error {
+	if !s.introspection {
+		return methodNotFound("system.methodSignature")
+	}
+	m, ok := s.codec.lookupMethod(args.Method)
+	if !ok {
+		return methodNotFound(args.Method)
+	}
+	reply.Signatures = [][]string{m.signature()}
+	return nil
+}
+
+// MethodHelp implements system.methodHelp.
+func (s *systemService) MethodHelp(r *http.Request, args *struct{ Method string }, reply *struct{ Help string }) error {
+	if !s.introspection {
+		return methodNotFound("system.methodHelp")
+	}
+	m, ok := s.codec.lookupMethod(args.Method)
+	if !ok {
+		return methodNotFound(args.Method)
+	}
+	reply.Help = m.help
+	return nil
+}
+
+func methodNotFound(method string) Fault {
+	fault := FaultMethodNotFound
+	fault.String += fmt.Sprintf(": %s", method)
+	return fault
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc"
+)
+
+func newIntrospectionServer(t *testing.T) *rpc.Server {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	if err := codec.RegisterService(s, new(Service1), "", MethodHelp("Multiply", "Multiplies A by B.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.RegisterService(s, new(Service2), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.EnableIntrospection(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestListMethods(t *testing.T) {
+	s := newIntrospectionServer(t)
+
+	var res struct{ Methods []string }
+	if err := executeAny(s, "system.listMethods", &struct{}{}, &res); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	expected := []string{
+		"Service1.Multiply",
+		"Service2.GetGreeting",
+		"system.listMethods",
+		"system.methodHelp",
+		"system.methodSignature",
+	}
+	if !reflect.DeepEqual(res.Methods, expected) {
+		t.Errorf("Wrong response: %v.", res.Methods)
+	}
+}
+
+func TestMethodSignature(t *testing.T) {
+	s := newIntrospectionServer(t)
+
+	var res struct{ Signatures [][]string }
+	if err := executeAny(s, "system.methodSignature", &struct{ Method string }{"Service2.GetGreeting"}, &res); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	expected := [][]string{{"string", "string", "int", "boolean"}}
+	if !reflect.DeepEqual(res.Signatures, expected) {
+		t.Errorf("Wrong response: %v.", res.Signatures)
+	}
+
+	err := executeAny(s, "system.methodSignature", &struct{ Method string }{"Service2.Missing"}, &res)
+	fault, ok := err.(Fault)
+	if !ok {
+		t.Fatal("expected error to be of concrete type Fault, but got", err)
+	}
+	if fault.Code != FaultMethodNotFound.Code {
+		t.Errorf("wrong fault code: %d", fault.Code)
+	}
+}
+
+func TestMethodHelp(t *testing.T) {
+	s := newIntrospectionServer(t)
+
+	var res struct{ Help string }
+	if err := executeAny(s, "system.methodHelp", &struct{ Method string }{"Service1.Multiply"}, &res); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if res.Help != "Multiplies A by B." {
+		t.Errorf("Wrong response: %v.", res.Help)
+	}
+}
+
+func TestParamTypes(t *testing.T) {
+	type Args struct {
+		A      int
+		hidden string
+		Skip   string `xmlrpc:"-"`
+		Data   Blob
+		Pair   [2]byte
+	}
+	tests := []struct {
+		typ      reflect.Type
+		expected []string
+	}{
+		{reflect.TypeOf(Args{}), []string{"int", "base64", "base64"}},
+		{reflect.TypeOf(Price{}), []string{"undef"}},
+		{reflect.TypeOf(time.Time{}), []string{"dateTime.iso8601"}},
+	}
+	for _, test := range tests {
+		if types := paramTypes(test.typ); !reflect.DeepEqual(types, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.typ, test.expected, types)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"strings"
+)
+
+// MethodMapper maps the method name of a request to the name of a registered
+// method, as in "Service.Method". It returns the name unchanged when it has no
+// mapping for it.
+type MethodMapper func(method string) string
+
+// SetMethodMapper sets the mapper applied to the method name of requests,
+// including the calls of system.multicall, that match no alias. Mappers are
+// combined with ChainMappers:
+//
+//     codec.SetMethodMapper(xml.ChainMappers(
+//         xml.RewritePrefix("blogger.", "Blog."),
+//         xml.SnakeToCamel,
+//     ))
+func (c *Codec) SetMethodMapper(mapper MethodMapper) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mapper = mapper
+}
+
+// resolve returns the name of the method called by name: its alias, or its
+// mapping by the mapper of the codec.
+func (c *Codec) resolve(name string) string {
+	c.mu.RLock()
+	method, ok := c.aliases[name]
+	mapper := c.mapper
+	c.mu.RUnlock()
+	if ok {
+		return method
+	}
+	if mapper != nil {
+		// The mapper runs unlocked, as it may look up the codec itself.
+		return mapper(name)
+	}
+	return name
+}
+
+// ChainMappers returns a mapper applying each of mappers in turn, each to the
+// name returned by the previous one.
+func ChainMappers(mappers ...MethodMapper) MethodMapper {
+	return func(method string) string {
+		for _, m := range mappers {
+			method = m(method)
+		}
+		return method
+	}
+}
+
+// SnakeToCamel maps snake_case and lowerCamelCase names, such as
+// "user_service.get_info" or "userService.getInfo", to the Go names of
+// "UserService.GetInfo".
+func SnakeToCamel(method string) string {
+	parts := strings.Split(method, ".")
+	for i, part := range parts {
+		parts[i] = captionString(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// RewritePrefix returns a mapper replacing the prefix of the names starting
+// with it, e.g. RewritePrefix("metaWeblog.", "Blog.") maps
+// "metaWeblog.newPost" to "Blog.newPost".
+func RewritePrefix(prefix, replacement string) MethodMapper {
+	return func(method string) string {
+		if strings.HasPrefix(method, prefix) {
+			return replacement + method[len(prefix):]
+		}
+		return method
+	}
+}
+
+// CaseInsensitive returns a mapper matching names case insensitively against
+// the methods registered through Codec.RegisterService, e.g. mapping
+// "service1.multiply" to "Service1.Multiply". Names matching several methods
+// are left unchanged.
+func (c *Codec) CaseInsensitive() MethodMapper {
+	return func(method string) string {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if _, ok := c.methods[method]; ok {
+			return method
+		}
+		match := ""
+		for name := range c.methods {
+			if strings.EqualFold(name, method) {
+				if match != "" {
+					return method
+				}
+				match = name
+			}
+		}
+		if match == "" {
+			return method
+		}
+		return match
+	}
+}
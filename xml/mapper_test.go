@@ -0,0 +1,94 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/rpc"
+)
+
+func TestMethodMappers(t *testing.T) {
+	tests := []struct {
+		mapper   MethodMapper
+		method   string
+		expected string
+	}{
+		{SnakeToCamel, "user_service.get_info", "UserService.GetInfo"},
+		{SnakeToCamel, "metaWeblog.newPost", "MetaWeblog.NewPost"},
+		{SnakeToCamel, "Service1.Multiply", "Service1.Multiply"},
+		{RewritePrefix("blogger.", "Blog."), "blogger.getUsersBlogs", "Blog.getUsersBlogs"},
+		{RewritePrefix("blogger.", "Blog."), "metaWeblog.newPost", "metaWeblog.newPost"},
+		{ChainMappers(RewritePrefix("blogger.", "blog."), SnakeToCamel), "blogger.getUsersBlogs", "Blog.GetUsersBlogs"},
+		{ChainMappers(), "Service1.Multiply", "Service1.Multiply"},
+	}
+	for _, test := range tests {
+		if got := test.mapper(test.method); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.method, test.expected, got)
+		}
+	}
+}
+
+func TestCodecMethodMapper(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	codec.RegisterService(s, new(Service1), "")
+	codec.EnableMulticall(s)
+
+	var res Service1Response
+	if err := executeAny(s, "service1.MULTIPLY", &Service1Request{4, 2}, &res); err == nil {
+		t.Error("expected an unknown method without mapper")
+	}
+
+	codec.SetMethodMapper(ChainMappers(RewritePrefix("math.", "service1."), codec.CaseInsensitive()))
+	if err := executeAny(s, "math.multiply", &Service1Request{4, 2}, &res); err != nil || res.Result != 8 {
+		t.Errorf("Wrong response: %v, %v.", res.Result, err)
+	}
+
+	codec.RegisterAlias("times", "Service1.Multiply")
+	var multi struct{ Results []interface{} }
+	calls := []interface{}{
+		map[string]interface{}{"methodName": "service1.multiply", "params": []interface{}{3, 2}},
+		map[string]interface{}{"methodName": "times", "params": []interface{}{5, 2}},
+	}
+	if err := executeAny(s, "system.multicall", calls, &multi); err != nil {
+		t.Fatal("system.multicall failed", err)
+	}
+	expected := fmt.Sprint([]interface{}{[]interface{}{6}, []interface{}{10}})
+	if fmt.Sprint(multi.Results) != expected {
+		t.Errorf("Expected %s, got %v", expected, multi.Results)
+	}
+}
+
+func TestCodecConcurrentAliases(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	s.RegisterService(new(Service1), "")
+	codec.SetMethodMapper(codec.CaseInsensitive())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			codec.RegisterAlias(fmt.Sprintf("alias%d", i), "Service1.Multiply")
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			var res Service1Response
+			executeAny(s, "Service1.Multiply", &Service1Request{i, 2}, &res)
+		}(i)
+	}
+	wg.Wait()
+
+	var res Service1Response
+	if err := executeAny(s, "alias7", &Service1Request{4, 2}, &res); err != nil || res.Result != 8 {
+		t.Errorf("Wrong response: %v, %v.", res.Result, err)
+	}
+}
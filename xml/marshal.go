@@ -0,0 +1,95 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"encoding"
+	"reflect"
+)
+
+// Marshaler is implemented by types that encode themselves as XML-RPC
+// values. MarshalXMLRPC returns the value to encode in place of the
+// receiver, e.g. a string holding an enum name.
+//
+// When a type doesn't implement Marshaler but implements
+// encoding.TextMarshaler, it's encoded as the <string> it returns.
+type Marshaler interface {
+	MarshalXMLRPC() (interface{}, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from XML-RPC
+// values. UnmarshalXMLRPC is passed a function which decodes the value into
+// any Go value, as Unmarshal does, e.g. into a string holding an enum name.
+//
+// When a type doesn't implement Unmarshaler but implements
+// encoding.TextUnmarshaler, it's decoded from a <string>.
+type Unmarshaler interface {
+	UnmarshalXMLRPC(unmarshal func(interface{}) error) error
+}
+
+var (
+	typeOfMarshaler       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	typeOfTextMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeOfUnmarshaler     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	typeOfTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// singleParam reports whether a struct of type t is sent as a single param
+// rather than as a param per field: a time.Time, or a struct which *t
+// implements Marshaler, Unmarshaler or their encoding.Text counterparts, such
+// as big.Int and big.Float.
+func singleParam(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return t == typeOfTime ||
+		ptr.Implements(typeOfMarshaler) || ptr.Implements(typeOfTextMarshaler) ||
+		ptr.Implements(typeOfUnmarshaler) || ptr.Implements(typeOfTextUnmarshaler)
+}
+
+// Marshal returns the XML-RPC encoding of v as a single <value> element.
+func Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := NewEncoder(&buffer).Encode(v)
+	return buffer.Bytes(), err
+}
+
+// Unmarshal parses a single XML-RPC <value> element and stores the result
+// in the value pointed to by v.
+func Unmarshal(data []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MarshalRequest returns the XML-RPC encoding of a methodCall of method
+// with args. It's the same as EncodeClientRequest.
+func MarshalRequest(method string, args ...interface{}) ([]byte, error) {
+	return EncodeClientRequest(method, args...)
+}
+
+// UnmarshalRequest parses an XML-RPC methodCall, stores its params in the
+// value pointed to by args and returns the method name. A nil args discards
+// the params.
+func UnmarshalRequest(data []byte, args interface{}) (string, error) {
+	return NewDecoder(bytes.NewReader(data)).DecodeRequest(args)
+}
+
+// MarshalResponse returns the XML-RPC encoding of a methodResponse holding
+// reply.
+func MarshalResponse(reply ...interface{}) ([]byte, error) {
+	xml, err := rpcResponse2XML(reply...)
+	return []byte(xml), err
+}
+
+// MarshalFault returns the XML-RPC encoding of a methodResponse holding
+// fault.
+func MarshalFault(fault Fault) []byte {
+	return []byte(fault2XML(fault))
+}
+
+// UnmarshalResponse parses an XML-RPC methodResponse and stores its params
+// in the value pointed to by reply. A fault response is returned as a Fault.
+// A nil reply discards the params.
+func UnmarshalResponse(data []byte, reply interface{}) error {
+	return NewDecoder(bytes.NewReader(data)).DecodeResponse(reply)
+}
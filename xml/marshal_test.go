@@ -0,0 +1,253 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	person := Person{"Johnny", "Doe", 33, Address{221, "Baker str.", "London"}}
+	data, err := Marshal(person)
+	if err != nil {
+		t.Error("Marshal failed", err)
+	}
+	expected := "<value><struct><member><name>Name</name><value><string>Johnny</string></value></member><member><name>Surname</name><value><string>Doe</string></value></member><member><name>Age</name><value><int>33</int></value></member><member><name>Address</name><value><struct><member><name>Number</name><value><int>221</int></value></member><member><name>Street</name><value><string>Baker str.</string></value></member><member><name>Country</name><value><string>London</string></value></member></struct></value></member></struct></value>"
+	if string(data) != expected {
+		t.Error("Marshal failed")
+		t.Error("Expected", expected)
+		t.Error("Got", string(data))
+	}
+
+	var got Person
+	if err := Unmarshal(data, &got); err != nil {
+		t.Error("Unmarshal failed", err)
+	}
+	if !reflect.DeepEqual(got, person) {
+		t.Error("Unmarshal failed")
+		t.Error("Expected", person)
+		t.Error("Got", got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var s string
+	if err := Unmarshal([]byte("<value><string>x</string></value>"), s); err == nil {
+		t.Error("expected error for non-pointer target")
+	}
+	if err, ok := Unmarshal([]byte("<param><value>x</value></param>"), &s).(*DecodeError); !ok || err.Line != 1 || err.Column != 7 {
+		t.Errorf("expected DecodeError at 1:7, but got: %v", err)
+	}
+	if err, ok := Unmarshal([]byte("<value>\n<string>x</string>"), &s).(*DecodeError); !ok || err.Line != 2 || err.Column != 18 {
+		t.Errorf("expected DecodeError at 2:18, but got: %v", err)
+	}
+
+	request := []byte("<methodCall><methodName>m</methodName><params><param><value><int>1</int></value></param></params></methodCall>")
+	response := []byte("<methodResponse><params><param><value><int>1</int></value></param></params></methodResponse>")
+	var nilPtr *Service1Request
+	for _, args := range []interface{}{Service1Request{}, nilPtr} {
+		if _, err := UnmarshalRequest(request, args); err == nil {
+			t.Errorf("%T: expected error for a target other than a non-nil pointer", args)
+		}
+		if err := UnmarshalResponse(response, args); err == nil {
+			t.Errorf("%T: expected error for a target other than a non-nil pointer", args)
+		}
+	}
+	if method, err := UnmarshalRequest(request, nil); err != nil || method != "m" {
+		t.Error("a nil target should discard the params", method, err)
+	}
+	if err := UnmarshalResponse(response, nil); err != nil {
+		t.Error("a nil target should discard the params", err)
+	}
+	if err := UnmarshalResponse(MarshalFault(FaultInternalError), nil); err != FaultInternalError {
+		t.Errorf("expected %v, but got: %v", FaultInternalError, err)
+	}
+}
+
+func TestMarshalRequest(t *testing.T) {
+	data, err := MarshalRequest("Service1.Multiply", &Service1Request{4, 2})
+	if err != nil {
+		t.Error("MarshalRequest failed", err)
+	}
+
+	var args Service1Request
+	method, err := UnmarshalRequest(data, &args)
+	if err != nil {
+		t.Error("UnmarshalRequest failed", err)
+	}
+	if method != "Service1.Multiply" || args != (Service1Request{4, 2}) {
+		t.Errorf("UnmarshalRequest failed: %s %v", method, args)
+	}
+}
+
+func TestMarshalResponse(t *testing.T) {
+	data, err := MarshalResponse("hello")
+	if err != nil {
+		t.Error("MarshalResponse failed", err)
+	}
+
+	var reply string
+	if err := UnmarshalResponse(data, &reply); err != nil {
+		t.Error("UnmarshalResponse failed", err)
+	}
+	if reply != "hello" {
+		t.Errorf("UnmarshalResponse failed: %s", reply)
+	}
+
+	err = UnmarshalResponse(MarshalFault(FaultInternalError), &reply)
+	if err != FaultInternalError {
+		t.Errorf("expected %v, but got: %v", FaultInternalError, err)
+	}
+}
+
+// Money is sent as a {amount, currency} struct holding the amount in cents.
+type Money int64
+
+func (m Money) MarshalXMLRPC() (interface{}, error) {
+	return map[string]interface{}{"amount": int64(m), "currency": "EUR"}, nil
+}
+
+func (m *Money) UnmarshalXMLRPC(unmarshal func(interface{}) error) error {
+	var v struct {
+		Amount   int64
+		Currency string
+	}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	if v.Currency != "EUR" {
+		return errors.New("unsupported currency " + v.Currency)
+	}
+	*m = Money(v.Amount)
+	return nil
+}
+
+// Color is sent as its name.
+type Color int
+
+var colorNames = []string{"red", "green", "blue"}
+
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(colorNames[c]), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	for i, name := range colorNames {
+		if name == string(text) {
+			*c = Color(i)
+			return nil
+		}
+	}
+	return errors.New("unknown color " + string(text))
+}
+
+func TestMarshaler(t *testing.T) {
+	type Item struct {
+		Price Money
+		Color Color
+	}
+	item := Item{Price: 1250, Color: 2}
+	data, err := Marshal(item)
+	if err != nil {
+		t.Error("Marshal failed", err)
+	}
+	expected := "<value><struct>" +
+		"<member><name>Price</name><value><struct>" +
+		"<member><name>amount</name><value><i8>1250</i8></value></member>" +
+		"<member><name>currency</name><value><string>EUR</string></value></member>" +
+		"</struct></value></member>" +
+		"<member><name>Color</name><value><string>blue</string></value></member>" +
+		"</struct></value>"
+	if string(data) != expected {
+		t.Error("Marshal failed")
+		t.Error("Expected", expected)
+		t.Error("Got", string(data))
+	}
+
+	var got Item
+	if err := Unmarshal(data, &got); err != nil {
+		t.Error("Unmarshal failed", err)
+	}
+	if got != item {
+		t.Errorf("Unmarshal failed: expected %v, got %v", item, got)
+	}
+
+	var c Color
+	if err := Unmarshal([]byte("<value><string>pink</string></value>"), &c); err == nil {
+		t.Error("expected error for unknown color")
+	}
+	var m Money
+	if err := Unmarshal([]byte("<value><string>EUR</string></value>"), &m); err == nil {
+		t.Error("expected error for mismatched type")
+	}
+}
+
+// Price is a struct sent as a decimal string of its cents.
+type Price struct {
+	Cents int64
+}
+
+func (p Price) MarshalXMLRPC() (interface{}, error) {
+	return fmt.Sprintf("%d.%02d", p.Cents/100, p.Cents%100), nil
+}
+
+func (p *Price) UnmarshalXMLRPC(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var units, cents int64
+	if _, err := fmt.Sscanf(s, "%d.%02d", &units, &cents); err != nil {
+		return err
+	}
+	p.Cents = units*100 + cents
+	return nil
+}
+
+func TestMarshalerParams(t *testing.T) {
+	data, err := MarshalRequest("Shop.Buy", Price{1234})
+	if err != nil {
+		t.Fatal("MarshalRequest failed", err)
+	}
+	expected := "<methodCall><methodName>Shop.Buy</methodName><params>" +
+		"<param><value><string>12.34</string></value></param>" +
+		"</params></methodCall>"
+	if string(data) != expected {
+		t.Error("MarshalRequest failed")
+		t.Error("Expected", expected)
+		t.Error("Got", string(data))
+	}
+	var price Price
+	if _, err := UnmarshalRequest(data, &price); err != nil || price.Cents != 1234 {
+		t.Error("UnmarshalRequest failed", price, err)
+	}
+
+	// big.Int is sent as a single param, by value or by pointer.
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.SetExtensions(true)
+	if err := encoder.EncodeRequest("Math.Big", *big.NewInt(42)); err != nil {
+		t.Fatal("EncodeRequest failed", err)
+	}
+	if !strings.Contains(buffer.String(), "<params><param><value><ex:biginteger>42</ex:biginteger></value></param></params>") {
+		t.Error("Wrong request:", buffer.String())
+	}
+	buffer.Reset()
+	if err := encoder.EncodeRequest("Math.Big", big.NewInt(42)); err != nil {
+		t.Fatal("EncodeRequest failed", err)
+	}
+	var n big.Int
+	decoder := NewDecoder(&buffer)
+	decoder.SetExtensions(true)
+	if _, err := decoder.DecodeRequest(&n); err != nil || n.Int64() != 42 {
+		t.Error("DecodeRequest failed", n.String(), err)
+	}
+}
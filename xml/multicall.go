@@ -0,0 +1,125 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/rpc"
+)
+
+// multicallCall is a single call of a system.multicall request.
+type multicallCall struct {
+	method  string
+	params  []param
+	err     error
+	decoder *Decoder
+}
+
+// multicallArgs holds the args of system.multicall. It's filled by
+// CodecRequest.ReadRequest straight from the request, since the params of
+// each call can only be decoded once the method is known.
+type multicallArgs = struct{ Calls []multicallCall }
+
+// EnableMulticall registers the system.multicall method on s.
+//
+// system.multicall takes an array of {methodName, params} structs and runs
+// each call in turn. The reply is an array holding, for every call, either
+// a one-element array with its result or a fault struct. Only the methods
+// registered through Codec.RegisterService can be called this way.
+func (c *Codec) EnableMulticall(s *rpc.Server) error {
+	if err := c.registerSystem(s, map[string]string{
+		"multicall": "Runs an array of calls and returns an array of their results.",
+	}); err != nil {
+		return err
+	}
+	c.system.multicall = true
+	return nil
+}
+
+// Multicall implements system.multicall.
+func (s *systemService) Multicall(r *http.Request, args *multicallArgs, reply *struct{ Results []interface{} }) error {
+	if !s.multicall {
+		return methodNotFound("system.multicall")
+	}
+	reply.Results = make([]interface{}, len(args.Calls))
+	for i, call := range args.Calls {
+		result, err := s.codec.call(r, call)
+		if err != nil {
+			reply.Results[i] = toFault(err)
+		} else {
+			reply.Results[i] = result
+		}
+	}
+	return nil
+}
+
+// call runs a single call of a system.multicall request and returns the
+// params of its response.
+func (c *Codec) call(r *http.Request, call multicallCall) ([]interface{}, error) {
+	if call.err != nil {
+		return nil, call.err
+	}
+	m, ok := c.lookupMethod(call.method)
+	if !ok {
+		return nil, methodNotFound(call.method)
+	}
+	if m.name == "system.multicall" {
+		fault := FaultInvalidParams
+		fault.String += ": recursive system.multicall is not allowed"
+		return nil, fault
+	}
+
+	args := reflect.New(m.argsType)
+	if err := call.decoder.params2RPC(call.params, args.Interface()); err != nil {
+		return nil, err
+	}
+	reply, err := m.invoke(r, args)
+	if err != nil {
+		return nil, err
+	}
+	return paramValues(reply), nil
+}
+
+// parseMulticall parses the calls of a system.multicall request.
+func (d *Decoder) parseMulticall(params []param) ([]multicallCall, error) {
+	if len(params) != 1 {
+		return nil, FaultWrongArgumentsNumber
+	}
+
+	values := params[0].Value.Array
+	calls := make([]multicallCall, len(values))
+	for i, v := range values {
+		calls[i] = d.value2Call(v)
+	}
+	return calls, nil
+}
+
+// value2Call converts a {methodName, params} struct into a multicallCall.
+// A malformed struct gives a call that fails with FaultInvalidParams.
+func (d *Decoder) value2Call(v value) multicallCall {
+	call := multicallCall{decoder: d}
+	for _, m := range v.Struct {
+		switch m.Name {
+		case "methodName":
+			field := reflect.ValueOf(&call.method).Elem()
+			if err := d.value2Field(m.Value, &field); err != nil {
+				call.err = err
+				return call
+			}
+		case "params":
+			for _, p := range m.Value.Array {
+				call.params = append(call.params, param{Value: p})
+			}
+		}
+	}
+	if call.method == "" {
+		fault := FaultInvalidParams
+		fault.String += ": missing methodName"
+		call.err = fault
+	}
+	return call
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/rpc"
+)
+
+type multicallTestCall struct {
+	MethodName string        `xml:"methodName"`
+	Params     []interface{} `xml:"params"`
+}
+
+func TestMulticall(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	codec.RegisterService(s, new(Service1), "")
+	if err := codec.EnableMulticall(s); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []interface{}{
+		multicallTestCall{"Service1.Multiply", []interface{}{4, 2}},
+		multicallTestCall{"Service1.Missing", nil},
+		multicallTestCall{"system.multicall", []interface{}{[]interface{}{}}},
+	}
+	buf, _ := EncodeClientRequest("system.multicall", calls)
+	r, _ := http.NewRequest("POST", "http://localhost:8080/", bytes.NewBuffer(buf))
+	r.Header.Set("Content-Type", "text/xml")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	expected := "<methodResponse><params><param><value><array><data>" +
+		"<value><array><data><value><int>8</int></value></data></array></value>" +
+		"<value><struct><member><name>faultCode</name><value><int>-32601</int></value></member><member><name>faultString</name><value><string>Requested Method Not Found: Service1.Missing</string></value></member></struct></value>" +
+		"<value><struct><member><name>faultCode</name><value><int>-32602</int></value></member><member><name>faultString</name><value><string>Invalid Method Parameters: recursive system.multicall is not allowed</string></value></member></struct></value>" +
+		"</data></array></value></param></params></methodResponse>"
+	if w.Body.String() != expected {
+		t.Error("Multicall failed")
+		t.Error("Expected", expected)
+		t.Error("Got", w.Body.String())
+	}
+}
+
+func TestMulticallDisabled(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	codec.EnableIntrospection(s)
+
+	var res struct{ Results []int }
+	err := execute(t, s, "system.Multicall", []interface{}{}, &res)
+	fault, ok := err.(Fault)
+	if !ok {
+		t.Fatal("expected error to be of concrete type Fault, but got", err)
+	}
+	if fault.Code != FaultMethodNotFound.Code {
+		t.Errorf("wrong fault code: %d", fault.Code)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	netrpc "net/rpc"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The codecs below frame each message as an HTTP/1.1 request or response on
+// the connection, as an XML-RPC peer keeping its connection alive would.
+// XML-RPC has no request id: responses are sent in the order of the
+// requests, which the client relies on to match them.
+
+// ----------------------------------------------------------------------------
+// ClientCodec
+// ----------------------------------------------------------------------------
+
+// NewClientCodec returns a net/rpc ClientCodec sending XML-RPC requests over
+// conn, as POST requests to /RPC2.
+func NewClientCodec(conn io.ReadWriteCloser) netrpc.ClientCodec {
+	host := "localhost"
+	if c, ok := conn.(net.Conn); ok && c.RemoteAddr() != nil {
+		host = c.RemoteAddr().String()
+	}
+	return &clientCodec{conn: conn, r: bufio.NewReader(conn), host: host}
+}
+
+type clientCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	host string
+
+	mu      sync.Mutex
+	pending []*netrpc.Request // requests waiting for a response, in order
+
+	// The response being read.
+	params  []param
+	decoder *Decoder
+}
+
+func (c *clientCodec) WriteRequest(r *netrpc.Request, args interface{}) error {
+	var body bytes.Buffer
+	if err := NewEncoder(&body).EncodeRequest(r.ServiceMethod, args); err != nil {
+		return err
+	}
+	req := &http.Request{
+		Method:        "POST",
+		URL:           &url.URL{Path: "/RPC2"},
+		Host:          c.host,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/xml"}},
+		ContentLength: int64(body.Len()),
+		Body:          ioutil.NopCloser(&body),
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, &netrpc.Request{ServiceMethod: r.ServiceMethod, Seq: r.Seq})
+	c.mu.Unlock()
+	return req.Write(c.conn)
+}
+
+func (c *clientCodec) ReadResponseHeader(r *netrpc.Response) error {
+	resp, err := http.ReadResponse(c.r, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return errors.New("xml: response without request")
+	}
+	req := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	r.ServiceMethod, r.Seq = req.ServiceMethod, req.Seq
+	c.params, c.decoder = nil, nil
+	if resp.StatusCode != http.StatusOK {
+		r.Error = "xml: unexpected HTTP status " + resp.Status
+		return drain(resp.Body)
+	}
+
+	decoder := NewDecoder(resp.Body)
+	ret, err := decoder.readMessage()
+	switch {
+	case err != nil:
+		r.Error = err.Error()
+	case !ret.Fault.IsEmpty():
+		r.Error = getFaultResponse(ret.Fault).Error()
+	default:
+		c.params, c.decoder = ret.Params, decoder
+	}
+	return drain(resp.Body)
+}
+
+func (c *clientCodec) ReadResponseBody(reply interface{}) error {
+	if reply == nil || c.decoder == nil {
+		return nil
+	}
+	return c.decoder.params2RPC(c.params, reply)
+}
+
+func (c *clientCodec) Close() error {
+	return c.conn.Close()
+}
+
+// ----------------------------------------------------------------------------
+// ServerCodec
+// ----------------------------------------------------------------------------
+
+// NewServerCodec returns a net/rpc ServerCodec answering the XML-RPC requests
+// read from conn. A method returning a Fault sends it as is.
+func NewServerCodec(conn io.ReadWriteCloser) netrpc.ServerCodec {
+	return &serverCodec{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		responses: make(map[uint64][]byte),
+		errs:      make(map[uint64]error),
+	}
+}
+
+type serverCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+
+	// The request being read.
+	current uint64
+	params  []param
+	decoder *Decoder
+
+	mu        sync.Mutex
+	seq       uint64            // sequence number of the next request
+	next      uint64            // sequence number of the next response to write
+	responses map[uint64][]byte // encoded responses waiting for the previous ones
+	errs      map[uint64]error  // decoding errors of the requests
+}
+
+func (c *serverCodec) ReadRequestHeader(r *netrpc.Request) error {
+	req, err := http.ReadRequest(c.r)
+	if err != nil {
+		return err
+	}
+	defer req.Body.Close()
+
+	c.mu.Lock()
+	r.Seq = c.seq
+	c.seq++
+	c.mu.Unlock()
+
+	c.current, c.params, c.decoder = r.Seq, nil, nil
+	decoder := NewDecoder(req.Body)
+	ret, err := decoder.readMessage()
+	if err != nil {
+		// The method is left empty, for net/rpc to answer with an error
+		// which WriteResponse replaces with err.
+		c.setError(r.Seq, err)
+		return drain(req.Body)
+	}
+	r.ServiceMethod = ret.Method
+	c.params, c.decoder = ret.Params, decoder
+	return drain(req.Body)
+}
+
+func (c *serverCodec) ReadRequestBody(args interface{}) error {
+	if args == nil || c.decoder == nil {
+		return nil
+	}
+	if err := c.decoder.params2RPC(c.params, args); err != nil {
+		c.setError(c.current, err)
+		return err
+	}
+	return nil
+}
+
+// setError records the decoding error of the request seq, to be sent
+// instead of the error net/rpc reports for it.
+func (c *serverCodec) setError(seq uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs[seq] = err
+}
+
+func (c *serverCodec) WriteResponse(r *netrpc.Response, reply interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if decodeErr, ok := c.errs[r.Seq]; ok {
+		err = decodeErr
+		delete(c.errs, r.Seq)
+	} else if r.Error != "" {
+		err = parseServerError(r.ServiceMethod, r.Error)
+	}
+	c.responses[r.Seq] = encodeResponse(NewEncoder, reply, err)
+
+	// Write the responses which no longer wait for a previous one.
+	for {
+		body, ok := c.responses[c.next]
+		if !ok {
+			return nil
+		}
+		delete(c.responses, c.next)
+		c.next++
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/xml; charset=utf-8"}},
+			ContentLength: int64(len(body)),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		}
+		if err := resp.Write(c.conn); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *serverCodec) Close() error {
+	return c.conn.Close()
+}
+
+// parseServerError returns the fault of the error message net/rpc reports
+// for a call of method: the Fault a method returned, FaultMethodNotFound for
+// an unknown method, FaultApplicationError with the message otherwise.
+func parseServerError(method, msg string) Fault {
+	if strings.HasPrefix(msg, "rpc: can't find ") {
+		return methodNotFound(method)
+	}
+	if i := strings.Index(msg, ": "); i > 0 {
+		if code, err := strconv.Atoi(msg[:i]); err == nil {
+			return Fault{Code: code, String: msg[i+2:]}
+		}
+	}
+	fault := FaultApplicationError
+	fault.String += fmt.Sprintf(": %s", msg)
+	return fault
+}
+
+// drain reads the rest of body, so that the next message can be read.
+func drain(body io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, body)
+	return err
+}
@@ -0,0 +1,150 @@
+// Copyright 2013 Ivan Danyliuk
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netrpc "net/rpc"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Arith struct{}
+
+func (t *Arith) Multiply(args *Service1Request, reply *Service1Response) error {
+	reply.Result = args.A * args.B
+	return nil
+}
+
+func (t *Arith) Divide(args *Service1Request, reply *Service1Response) error {
+	if args.B == 0 {
+		return errors.New("division by zero")
+	}
+	reply.Result = args.A / args.B
+	return nil
+}
+
+func (t *Arith) Fail(args *Service1Request, reply *Service1Response) error {
+	return Fault{Code: args.A, String: "custom fault"}
+}
+
+// Sleep answers after A milliseconds, so that responses are ready out of
+// order.
+func (t *Arith) Sleep(args *Service1Request, reply *Service1Response) error {
+	time.Sleep(time.Duration(args.A) * time.Millisecond)
+	reply.Result = args.A
+	return nil
+}
+
+func newNetRPCClient(t *testing.T) *netrpc.Client {
+	server := netrpc.NewServer()
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	return netrpc.NewClientWithCodec(NewClientCodec(cli))
+}
+
+func TestNetRPCCodecs(t *testing.T) {
+	client := newNetRPCClient(t)
+	defer client.Close()
+
+	var res Service1Response
+	if err := client.Call("Arith.Multiply", &Service1Request{4, 2}, &res); err != nil || res.Result != 8 {
+		t.Errorf("Wrong response: %v, %v.", res.Result, err)
+	}
+
+	tests := []struct {
+		method string
+		args   interface{}
+		err    string
+	}{
+		{"Arith.Divide", &Service1Request{4, 0}, "-32500: Application Error: division by zero"},
+		{"Arith.Fail", &Service1Request{42, 0}, "42: custom fault"},
+		{"Arith.Sub", &Service1Request{4, 2}, "-32601: Requested Method Not Found: Arith.Sub"},
+		{"Arith.Multiply", "four", `-32602: Invalid Method Parameters: fields type mismatch: string != int at params[0]`},
+	}
+	for _, test := range tests {
+		err := client.Call(test.method, test.args, &res)
+		if _, ok := err.(netrpc.ServerError); !ok || err.Error() != test.err {
+			t.Errorf("%s: expected %q, got %v", test.method, test.err, err)
+		}
+	}
+
+	// The connection is still usable after errors.
+	if err := client.Call("Arith.Multiply", &Service1Request{3, 3}, &res); err != nil || res.Result != 9 {
+		t.Errorf("Wrong response: %v, %v.", res.Result, err)
+	}
+}
+
+func TestNetRPCCodecsOrdering(t *testing.T) {
+	client := newNetRPCClient(t)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for _, delay := range []int{30, 1, 20, 5, 10} {
+		wg.Add(1)
+		go func(delay int) {
+			defer wg.Done()
+			var res Service1Response
+			if err := client.Call("Arith.Sleep", &Service1Request{delay, 0}, &res); err != nil || res.Result != delay {
+				t.Errorf("Wrong response for %d: %v, %v.", delay, res.Result, err)
+			}
+		}(delay)
+	}
+	wg.Wait()
+}
+
+func TestNetRPCClientCodecOverHTTP(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterService(new(Service1), ""); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := netrpc.NewClientWithCodec(NewClientCodec(conn))
+	defer client.Close()
+
+	for i := 1; i <= 3; i++ {
+		var res Service1Response
+		if err := client.Call("Service1.Multiply", &Service1Request{i, 2}, &res); err != nil || res.Result != 2*i {
+			t.Errorf("Wrong response: %v, %v.", res.Result, err)
+		}
+	}
+}
+
+func TestNetRPCServerCodecMalformed(t *testing.T) {
+	server := netrpc.NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServeCodec(NewServerCodec(srv))
+
+	body := "<methodCall><methodName>Arith.Multiply</methodName><params>"
+	go cli.Write([]byte("POST /RPC2 HTTP/1.1\r\nHost: localhost\r\nContent-Length: " +
+		strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+	resp, err := http.ReadResponse(bufio.NewReader(cli), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res Service1Response
+	err = DecodeClientResponse(resp.Body, &res)
+	if fault, ok := err.(Fault); !ok || fault.Code != FaultDecode.Code {
+		t.Errorf("expected FaultDecode, got %v", err)
+	}
+}
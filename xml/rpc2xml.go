@@ -5,44 +5,227 @@
 package xml
 
 import (
+	"bufio"
+	"encoding"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-type stringWriter interface {
-	io.Writer
-	io.StringWriter
+// ----------------------------------------------------------------------------
+// Encoder
+// ----------------------------------------------------------------------------
+
+// Encoder writes XML-RPC values, requests and responses to an output stream.
+//
+// The encoding is written as it's produced, so the size of the payload
+// doesn't affect the memory used by the Encoder. Encoding stops at the first
+// value that can't be encoded, leaving the output incomplete: the error must
+// be checked before the output is sent.
+type Encoder struct {
+	w          *bufio.Writer
+	timeLayout string
+	loc        *time.Location
+	extensions bool
+	xmlns      bool // declare the extensions namespace on the next <value>
+	nilPolicy  NilPolicy
+	charPolicy InvalidCharPolicy
+	nanPolicy  NonFinitePolicy
+	visiting   map[ptrKey]bool // pointers being encoded, to detect cycles
+}
+
+// ptrKey identifies a pointer being encoded. The type tells a pointer to a
+// struct from a pointer to its first field.
+type ptrKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// NilPolicy selects how an Encoder encodes nil slices and maps.
+type NilPolicy int
+
+const (
+	// NilAsEmpty encodes nil slices and maps as an empty array, base64 or
+	// struct. It's the default.
+	NilAsEmpty NilPolicy = iota
+	// NilAsNil encodes nil slices and maps as <nil/>, like nil pointers.
+	NilAsNil
+)
+
+// InvalidCharPolicy selects how an Encoder handles characters XML 1.0
+// doesn't allow in text, such as most control characters and invalid UTF-8.
+type InvalidCharPolicy int
+
+const (
+	// RejectInvalidChars stops encoding with an InvalidCharError. It's the
+	// default.
+	RejectInvalidChars InvalidCharPolicy = iota
+	// ReplaceInvalidChars replaces invalid characters with U+FFFD.
+	ReplaceInvalidChars
+	// StripInvalidChars drops invalid characters.
+	StripInvalidChars
+)
+
+// NonFinitePolicy selects how an Encoder encodes NaN and infinite floats,
+// which the XML-RPC specification has no representation for.
+type NonFinitePolicy int
+
+const (
+	// RejectNonFinite stops encoding with an UnsupportedValueError. It's the
+	// default.
+	RejectNonFinite NonFinitePolicy = iota
+	// NonFiniteAsNil encodes NaN and infinite floats as <nil/>.
+	NonFiniteAsNil
+	// NonFiniteAsText encodes NaN and infinite floats as NaN, Infinity and
+	// -Infinity, which Python, Java and Go peers parse back.
+	NonFiniteAsText
+)
+
+// DateTimeLayout is the layout of dateTime.iso8601 values in the XML-RPC
+// specification. It has no time zone.
+const DateTimeLayout = "20060102T15:04:05"
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w), timeLayout: DateTimeLayout, loc: time.UTC}
+}
+
+// SetTimeLayout sets the layout, as used by time.Format, of encoded
+// dateTime.iso8601 values. The default is DateTimeLayout; peers that
+// understand offsets may be sent e.g. "20060102T15:04:05Z07:00".
+func (e *Encoder) SetTimeLayout(layout string) {
+	e.timeLayout = layout
+}
+
+// SetTimeLocation makes the encoder convert times to loc before formatting
+// them. The default is time.UTC, as DateTimeLayout has no offset; with a nil
+// loc, times are formatted in their own location.
+func (e *Encoder) SetTimeLocation(loc *time.Location) {
+	e.loc = loc
+}
+
+// SetNilPolicy sets how nil slices and maps are encoded. Nil pointers and
+// interfaces are always encoded as <nil/>.
+func (e *Encoder) SetNilPolicy(policy NilPolicy) {
+	e.nilPolicy = policy
+}
+
+// SetInvalidCharPolicy sets how characters XML doesn't allow are handled in
+// strings, struct member names and method names.
+func (e *Encoder) SetInvalidCharPolicy(policy InvalidCharPolicy) {
+	e.charPolicy = policy
+}
+
+// SetNonFinitePolicy sets how NaN and infinite floats are encoded.
+func (e *Encoder) SetNonFinitePolicy(policy NonFinitePolicy) {
+	e.nanPolicy = policy
+}
+
+// Encode writes the XML-RPC encoding of v as a single <value> element.
+func (e *Encoder) Encode(v interface{}) error {
+	e.xmlns = e.extensions
+	err := e.rpc2XML(v)
+	if path := errorPath(err); path != nil && *path != "" {
+		// Root the path at the type of v, as params are rooted at theirs.
+		t := reflect.TypeOf(v)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		*path = strings.TrimPrefix(t.Name()+*path, ".")
+	}
+	return e.flush(err)
+}
+
+// EncodeRequest writes a methodCall of method with args.
+func (e *Encoder) EncodeRequest(method string, args ...interface{}) error {
+	e.w.WriteString("<methodCall" + e.namespaces() + "><methodName>")
+	if err := e.escapeText(method); err != nil {
+		return e.flush(err)
+	}
+	e.w.WriteString("</methodName>")
+	if err := e.rpcParams2XML(args...); err != nil {
+		return e.flush(err)
+	}
+	e.w.WriteString("</methodCall>")
+	return e.flush(nil)
+}
+
+// EncodeResponse writes a methodResponse holding reply.
+func (e *Encoder) EncodeResponse(reply ...interface{}) error {
+	e.w.WriteString("<methodResponse" + e.namespaces() + ">")
+	if err := e.rpcParams2XML(reply...); err != nil {
+		return e.flush(err)
+	}
+	e.w.WriteString("</methodResponse>")
+	return e.flush(nil)
+}
+
+// EncodeFault writes a methodResponse holding fault.
+func (e *Encoder) EncodeFault(fault Fault) error {
+	e.w.WriteString("<methodResponse" + e.namespaces() + "><fault>")
+	if err := e.rpc2XML(fault); err != nil {
+		return e.flush(err)
+	}
+	e.w.WriteString("</fault></methodResponse>")
+	return e.flush(nil)
+}
+
+// flush writes the buffered data to the underlying writer. It returns err,
+// or the write error if err is nil.
+func (e *Encoder) flush(err error) error {
+	if werr := e.w.Flush(); err == nil {
+		err = werr
+	}
+	return err
 }
 
 func rpcRequest2XML(method string, rpc ...interface{}) (string, error) {
 	buffer := new(strings.Builder)
-	buffer.WriteString("<methodCall><methodName>")
-
-	buffer.WriteString(method)
-	buffer.WriteString("</methodName>")
-	err := rpcParams2XML(buffer, rpc...)
-	buffer.WriteString("</methodCall>")
+	err := NewEncoder(buffer).EncodeRequest(method, rpc...)
 	return buffer.String(), err
 }
 
 func rpcResponse2XML(rpc ...interface{}) (string, error) {
 	buffer := new(strings.Builder)
-	buffer.WriteString("<methodResponse>")
-	err := rpcParams2XML(buffer, rpc...)
-	buffer.WriteString("</methodResponse>")
+	err := NewEncoder(buffer).EncodeResponse(rpc...)
 	return buffer.String(), err
 }
 
-func rpcParams2XML(buffer stringWriter, rpc ...interface{}) error {
-	var err error
-	buffer.WriteString("<params>")
+func (e *Encoder) rpcParams2XML(rpc ...interface{}) error {
+	e.w.WriteString("<params>")
+	for _, p := range params(rpc...) {
+		e.w.WriteString("<param>")
+		if err := e.rpc2XML(p.value); err != nil {
+			return withPath(err, p.path)
+		}
+		e.w.WriteString("</param>")
+	}
+	e.w.WriteString("</params>")
+	return nil
+}
+
+// paramValue is a value sent as a param, with the path it's reported at in
+// an encoding error.
+type paramValue struct {
+	path  string
+	value interface{}
+}
 
+// params returns the values rpc is sent as params: the fields of a struct
+// are sent as separate params, any other value, or a struct singleParam
+// reports, as a single one. As with members, unexported fields and fields
+// tagged "-" aren't sent.
+func params(rpc ...interface{}) []paramValue {
+	var values []paramValue
 	var elem reflect.Value
-	for _, r := range rpc {
+	for i, r := range rpc {
 		val := reflect.ValueOf(r)
 		switch val.Kind() {
 		case reflect.Interface, reflect.Ptr:
@@ -50,59 +233,305 @@ func rpcParams2XML(buffer stringWriter, rpc ...interface{}) error {
 		default:
 			elem = val
 		}
+		if !elem.IsValid() {
+			values = append(values, paramValue{fmt.Sprintf("params[%d]", i), r})
+			continue
+		}
+		if elem.Kind() == reflect.Struct && singleParam(elem.Type()) {
+			if val.Kind() != reflect.Ptr {
+				// The methods of *T are called on a copy, as the value
+				// can't be addressed.
+				val = reflect.New(elem.Type())
+				val.Elem().Set(elem)
+			}
+			values = append(values, paramValue{fmt.Sprintf("params[%d]", i), val.Interface()})
+			continue
+		}
 		if elem.Kind() != reflect.Struct {
-			buffer.WriteString("<param>")
-			err = rpc2XML(buffer, elem.Interface())
-			buffer.WriteString("</param>")
+			values = append(values, paramValue{fmt.Sprintf("params[%d]", i), elem.Interface()})
 			continue
 		}
 
-		numField := elem.NumField()
-
-		for i := 0; i < numField; i++ {
-			buffer.WriteString("<param>")
-			err = rpc2XML(buffer, elem.Field(i).Interface())
-			buffer.WriteString("</param>")
+		typ := elem.Type()
+		for _, fi := range structFields(typ) {
+			path := typ.FieldByIndex(fi.index).Name
+			if typ.Name() != "" {
+				path = typ.Name() + "." + path
+			}
+			values = append(values, paramValue{path, elem.FieldByIndex(fi.index).Interface()})
 		}
 	}
+	return values
+}
 
-	buffer.WriteString("</params>")
-	return err
+// paramValues returns the values rpc is sent as params, see params.
+func paramValues(rpc ...interface{}) []interface{} {
+	var values []interface{}
+	for _, p := range params(rpc...) {
+		values = append(values, p.value)
+	}
+	return values
 }
 
-func rpc2XML(w stringWriter, value interface{}) error {
-	w.WriteString("<value>")
-	switch reflect.ValueOf(value).Kind() {
-	case reflect.Int:
-		fmt.Fprintf(w, "<int>%d</int>", value.(int))
-	case reflect.Float64:
-		fmt.Fprintf(w, "<double>%f</double>", value.(float64))
+func (e *Encoder) rpc2XML(value interface{}) error {
+	if e.extensions {
+		if ok, err := e.big2XML(value); ok {
+			return err
+		}
+	}
+	if v, ok, err := marshalValue(value); ok {
+		if err != nil {
+			return err
+		}
+		return e.rpc2XML(v)
+	}
+
+	val := reflect.ValueOf(value)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		// A pointer to a value being encoded would be followed forever.
+		key := ptrKey{val.Pointer(), val.Type()}
+		if e.visiting[key] {
+			return &UnsupportedValueError{Value: val, Str: "encountered a cycle via " + val.Type().String()}
+		}
+		if e.visiting == nil {
+			e.visiting = make(map[ptrKey]bool)
+		}
+		e.visiting[key] = true
+		err := e.rpc2XML(val.Elem().Interface())
+		delete(e.visiting, key)
+		return err
+	}
+
+	w := e.w
+	e.startValue()
+	var err error
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.WriteString(e.int2XML(val.Int(), val.Kind()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := val.Uint(); u > math.MaxInt64 {
+			err = &UnsupportedValueError{Value: val, Str: strconv.FormatUint(u, 10)}
+		} else {
+			w.WriteString(e.int2XML(int64(u), val.Kind()))
+		}
+	case reflect.Float32, reflect.Float64:
+		var s string
+		if s, err = e.float2XML(val); err == nil {
+			w.WriteString(s)
+		}
 	case reflect.String:
-		w.Write([]byte(string2XML(value.(string))))
+		err = e.string2XML(val.String())
 	case reflect.Bool:
-		w.Write([]byte(bool2XML(value.(bool))))
+		w.WriteString(bool2XML(val.Bool()))
 	case reflect.Struct:
 		if reflect.TypeOf(value).String() != "time.Time" {
-			struct2XML(w, value)
+			err = e.struct2XML(value)
 		} else {
-			w.Write([]byte(time2XML(value.(time.Time))))
+			e.time2XML(value.(time.Time))
 		}
-	case reflect.Slice, reflect.Array:
-		// FIXME: is it the best way to recognize '[]byte'?
-		if reflect.TypeOf(value).String() != "[]uint8" {
-			array2XML(w, value)
+	case reflect.Map:
+		if val.IsNil() && e.nilPolicy == NilAsNil {
+			w.WriteString(e.nil2XML())
 		} else {
-			w.WriteString(base642XML(value.([]byte)))
+			err = e.map2XML(val)
 		}
-	case reflect.Ptr:
-		if reflect.ValueOf(value).IsNil() {
-			w.WriteString("<nil/>")
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.IsNil() && e.nilPolicy == NilAsNil {
+			w.WriteString(e.nil2XML())
+			break
 		}
+		if isBytes(val.Type()) {
+			e.base642XML(bytesOf(val))
+		} else {
+			err = e.array2XML(value)
+		}
+	case reflect.Ptr, reflect.Invalid:
+		// A nil pointer, or nil itself.
+		w.WriteString(e.nil2XML())
+	default:
+		err = &UnsupportedTypeError{Type: val.Type()}
+	}
+	if err != nil {
+		return err
 	}
 	w.WriteString("</value>")
 	return nil
 }
 
+// UnsupportedValueError is returned by an Encoder when asked to encode a
+// value XML-RPC has no representation for, such as a NaN or infinite float
+// with the RejectNonFinite policy.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+	// Path locates the value, as in an UnsupportedTypeError.
+	Path string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	if e.Path == "" {
+		return "xml: unsupported value: " + e.Str
+	}
+	return "xml: unsupported value " + e.Str + " at " + e.Path
+}
+
+// UnsupportedTypeError is returned by an Encoder when asked to encode a
+// value of a type XML-RPC has no representation for, such as a channel, a
+// function, a complex number or a map without string keys.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	// Path locates the value, e.g. Args.Items[3].Owner for the Owner field
+	// of the fourth element of the Items param of an Args struct. It's empty
+	// for the value passed to Encode itself.
+	Path string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Path == "" {
+		return "xml: unsupported type: " + e.Type.String()
+	}
+	return "xml: unsupported type " + e.Type.String() + " at " + e.Path
+}
+
+// InvalidCharError is returned by an Encoder with the RejectInvalidChars
+// policy when asked to encode text holding a character XML 1.0 doesn't allow.
+type InvalidCharError struct {
+	// Rune is the character, or utf8.RuneError for invalid UTF-8.
+	Rune rune
+	// Path locates the string or struct member name holding the character,
+	// as in an UnsupportedTypeError. It's empty for a method name.
+	Path string
+}
+
+func (e *InvalidCharError) Error() string {
+	msg := fmt.Sprintf("xml: invalid character %U", e.Rune)
+	if e.Rune == utf8.RuneError {
+		msg = "xml: invalid UTF-8"
+	}
+	if e.Path == "" {
+		return msg
+	}
+	return msg + " at " + e.Path
+}
+
+// withPath prefixes the path of err with prefix, if err is an
+// UnsupportedTypeError, an UnsupportedValueError or an InvalidCharError.
+func withPath(err error, prefix string) error {
+	if path := errorPath(err); path != nil {
+		*path = prefix + *path
+	}
+	return err
+}
+
+// errorPath returns the path of err, if err is an UnsupportedTypeError, an
+// UnsupportedValueError or an InvalidCharError.
+func errorPath(err error) *string {
+	switch e := err.(type) {
+	case *UnsupportedTypeError:
+		return &e.Path
+	case *UnsupportedValueError:
+		return &e.Path
+	case *InvalidCharError:
+		return &e.Path
+	}
+	return nil
+}
+
+// marshalValue returns the value a Marshaler or encoding.TextMarshaler is
+// encoded as, and whether value implements either of them.
+func marshalValue(value interface{}) (interface{}, bool, error) {
+	if val := reflect.ValueOf(value); val.Kind() == reflect.Ptr && val.IsNil() {
+		return nil, false, nil
+	}
+	switch m := value.(type) {
+	case time.Time, *time.Time:
+		// time.Time is a TextMarshaler, but has its own XML-RPC type.
+	case Marshaler:
+		v, err := m.MarshalXMLRPC()
+		return v, true, err
+	case encoding.TextMarshaler:
+		text, err := m.MarshalText()
+		return string(text), true, err
+	}
+	return nil, false, nil
+}
+
+// startValue writes the <value> start tag.
+func (e *Encoder) startValue() {
+	if e.xmlns {
+		e.w.WriteString("<value" + e.namespaces() + ">")
+		e.xmlns = false
+		return
+	}
+	e.w.WriteString("<value>")
+}
+
+// int2XML encodes i, of kind k, as <int>, or as <i8> for the 64-bit kinds
+// int64, uint, uint32, uint64 and uintptr, whatever their value. An int is
+// encoded as <i8> only when it doesn't fit in 32 bits. With the extensions,
+// int8 and int16 are encoded as <ex:i1> and <ex:i2>, and <i8> as <ex:i8>.
+func (e *Encoder) int2XML(i int64, k reflect.Kind) string {
+	switch {
+	case e.extensions && k == reflect.Int8:
+		return fmt.Sprintf("<ex:i1>%d</ex:i1>", i)
+	case e.extensions && k == reflect.Int16:
+		return fmt.Sprintf("<ex:i2>%d</ex:i2>", i)
+	case isInt64Kind(k), i < math.MinInt32 || i > math.MaxInt32:
+		if e.extensions {
+			return fmt.Sprintf("<ex:i8>%d</ex:i8>", i)
+		}
+		return fmt.Sprintf("<i8>%d</i8>", i)
+	}
+	return fmt.Sprintf("<int>%d</int>", i)
+}
+
+// isInt64Kind reports whether k is encoded as <i8>, as its values don't all
+// fit in <int>.
+func isInt64Kind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// float2XML encodes a float as <double>, or as <ex:float> for a float32 with
+// the extensions. It's written with the fewest digits that decode back to the
+// same float, without the exponent the specification doesn't allow.
+func (e *Encoder) float2XML(val reflect.Value) (string, error) {
+	elem, bits := "double", 64
+	if val.Kind() == reflect.Float32 {
+		bits = 32
+		if e.extensions {
+			elem = "ex:float"
+		}
+	}
+
+	var text string
+	f := val.Float()
+	switch {
+	case !math.IsNaN(f) && !math.IsInf(f, 0):
+		text = strconv.FormatFloat(f, 'f', -1, bits)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+	case e.nanPolicy == NonFiniteAsNil:
+		return e.nil2XML(), nil
+	case e.nanPolicy == NonFiniteAsText:
+		switch {
+		case math.IsNaN(f):
+			text = "NaN"
+		case f > 0:
+			text = "Infinity"
+		default:
+			text = "-Infinity"
+		}
+	default:
+		return "", &UnsupportedValueError{Value: val, Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+	return fmt.Sprintf("<%s>%s</%[1]s>", elem, text), nil
+}
+
 func bool2XML(value bool) string {
 	var b string
 	if value {
@@ -113,60 +542,188 @@ func bool2XML(value bool) string {
 	return fmt.Sprintf("<boolean>%s</boolean>", b)
 }
 
-func string2XML(value string) string {
-	value = strings.Replace(value, "&", "&amp;", -1)
-	value = strings.Replace(value, "\"", "&quot;", -1)
-	value = strings.Replace(value, "<", "&lt;", -1)
-	value = strings.Replace(value, ">", "&gt;", -1)
-	return fmt.Sprintf("<string>%s</string>", value)
+func (e *Encoder) string2XML(value string) error {
+	e.w.WriteString("<string>")
+	if err := e.escapeText(value); err != nil {
+		return err
+	}
+	e.w.WriteString("</string>")
+	return nil
+}
+
+// escapeText writes s with the XML special characters escaped, and the
+// characters XML doesn't allow handled according to the policy of the
+// encoder. A carriage return is escaped too, as a parser would otherwise
+// read it as a line feed.
+func (e *Encoder) escapeText(s string) error {
+	last := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		var esc string
+		switch {
+		case r == '&':
+			esc = "&amp;"
+		case r == '"':
+			esc = "&quot;"
+		case r == '<':
+			esc = "&lt;"
+		case r == '>':
+			esc = "&gt;"
+		case r == '\r':
+			esc = "&#xD;"
+		case r == utf8.RuneError && size == 1 || !isXMLChar(r):
+			switch e.charPolicy {
+			case ReplaceInvalidChars:
+				esc = "\uFFFD"
+			case StripInvalidChars:
+			default:
+				return &InvalidCharError{Rune: r}
+			}
+		default:
+			i += size
+			continue
+		}
+		e.w.WriteString(s[last:i])
+		e.w.WriteString(esc)
+		i += size
+		last = i
+	}
+	e.w.WriteString(s[last:])
+	return nil
+}
+
+// isXMLChar reports whether r is a character XML 1.0 allows.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
 }
 
-func struct2XML(w stringWriter, value interface{}) {
+// name2XML writes the <name> of a struct member.
+func (e *Encoder) name2XML(name string) error {
+	e.w.WriteString("<name>")
+	if err := e.escapeText(name); err != nil {
+		return err
+	}
+	e.w.WriteString("</name>")
+	return nil
+}
+
+func (e *Encoder) struct2XML(value interface{}) error {
+	w := e.w
 	w.WriteString("<struct>")
-	for i := 0; i < reflect.TypeOf(value).NumField(); i++ {
-		field := reflect.ValueOf(value).Field(i)
-		fieldType := reflect.TypeOf(value).Field(i)
+	val := reflect.ValueOf(value)
+	for _, fi := range structFields(val.Type()) {
+		field := val.FieldByIndex(fi.index)
+		empty := (fi.omitEmpty || fi.nilZero) && isEmptyValue(field)
+		if fi.omitEmpty && empty {
+			continue
+		}
+		path := "." + val.Type().FieldByIndex(fi.index).Name
+		w.WriteString("<member>")
+		if err := e.name2XML(fi.name); err != nil {
+			return withPath(err, path)
+		}
+		if fi.nilZero && empty {
+			w.WriteString("<value>" + e.nil2XML() + "</value>")
+		} else if err := e.rpc2XML(field.Interface()); err != nil {
+			return withPath(err, path)
+		}
+		w.WriteString("</member>")
+	}
+	w.WriteString("</struct>")
+	return nil
+}
+
+// map2XML encodes a map as a struct, with members sorted by name so that the
+// output is stable. Keys must be strings or implement encoding.TextMarshaler.
+func (e *Encoder) map2XML(val reflect.Value) error {
+	type mapMember struct {
+		name string
+		key  reflect.Value
+	}
+	members := make([]mapMember, 0, val.Len())
+	for _, key := range val.MapKeys() {
 		var name string
-		if fieldType.Tag.Get("xml") != "" {
-			name = fieldType.Tag.Get("xml")
+		if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+			text, err := tm.MarshalText()
+			if err != nil {
+				return err
+			}
+			name = string(text)
+		} else if key.Kind() == reflect.String {
+			name = key.String()
 		} else {
-			name = fieldType.Name
+			return &UnsupportedTypeError{Type: val.Type()}
 		}
+		members = append(members, mapMember{name, key})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].name < members[j].name
+	})
+
+	w := e.w
+	w.WriteString("<struct>")
+	for _, m := range members {
+		path := fmt.Sprintf("[%q]", m.name)
 		w.WriteString("<member>")
-		fmt.Fprintf(w, "<name>%s</name>", name)
-		rpc2XML(w, field.Interface())
+		if err := e.name2XML(m.name); err != nil {
+			return withPath(err, path)
+		}
+		if err := e.rpc2XML(val.MapIndex(m.key).Interface()); err != nil {
+			return withPath(err, path)
+		}
 		w.WriteString("</member>")
 	}
 	w.WriteString("</struct>")
-	return
+	return nil
 }
 
-func array2XML(w stringWriter, value interface{}) {
-	w.WriteString("<array><data>")
+func (e *Encoder) array2XML(value interface{}) error {
+	e.w.WriteString("<array><data>")
 	for i := 0; i < reflect.ValueOf(value).Len(); i++ {
-		rpc2XML(w, reflect.ValueOf(value).Index(i).Interface())
+		if err := e.rpc2XML(reflect.ValueOf(value).Index(i).Interface()); err != nil {
+			return withPath(err, fmt.Sprintf("[%d]", i))
+		}
 	}
-	w.WriteString("</data></array>")
+	e.w.WriteString("</data></array>")
+	return nil
 }
 
-func time2XML(t time.Time) string {
-	/*
-		// TODO: find out whether we need to deal
-		// here with TZ
-		var tz string;
-		zone, offset := t.Zone()
-		if zone == "UTC" {
-			tz = "Z"
-		} else {
-			tz = fmt.Sprintf("%03d00", offset / 3600 )
-		}
-	*/
-	return fmt.Sprintf("<dateTime.iso8601>%04d%02d%02dT%02d:%02d:%02d</dateTime.iso8601>",
-		t.Year(), t.Month(), t.Day(),
-		t.Hour(), t.Minute(), t.Second())
+func (e *Encoder) time2XML(t time.Time) {
+	if e.loc != nil {
+		t = t.In(e.loc)
+	}
+	e.w.WriteString("<dateTime.iso8601>")
+	e.w.WriteString(t.Format(e.timeLayout))
+	e.w.WriteString("</dateTime.iso8601>")
+}
+
+// base642XML encodes data straight into the output, without holding the
+// whole encoded string in memory.
+// isBytes reports whether t, a slice or an array of bytes, is encoded as
+// <base64>. Named types such as []B or [4]B, for a byte kind B, count too.
+func isBytes(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+// bytesOf returns the bytes of val, of a type isBytes reports.
+func bytesOf(val reflect.Value) []byte {
+	if val.Kind() == reflect.Slice {
+		return val.Bytes()
+	}
+	data := make([]byte, val.Len())
+	for i := range data {
+		data[i] = byte(val.Index(i).Uint())
+	}
+	return data
 }
 
-func base642XML(data []byte) string {
-	str := base64.StdEncoding.EncodeToString(data)
-	return fmt.Sprintf("<base64>%s</base64>", str)
+func (e *Encoder) base642XML(data []byte) {
+	e.w.WriteString("<base64>")
+	encoder := base64.NewEncoder(base64.StdEncoding, e.w)
+	encoder.Write(data)
+	encoder.Close()
+	e.w.WriteString("</base64>")
 }
@@ -5,7 +5,15 @@
 package xml
 
 import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -26,7 +34,7 @@ type StructRPC2XML struct {
 }
 
 func TestRPC2XML(t *testing.T) {
-	req := &StructRPC2XML{123, 3.145926, "Hello, World!", false, SubStructRPC2XML{42, "I'm Bar", []int{1, 2, 3}}, time.Date(2012, time.July, 17, 14, 8, 55, 0, time.Local), []byte("you can't read this!")}
+	req := &StructRPC2XML{123, 3.145926, "Hello, World!", false, SubStructRPC2XML{42, "I'm Bar", []int{1, 2, 3}}, time.Date(2012, time.July, 17, 14, 8, 55, 0, time.UTC), []byte("you can't read this!")}
 	xml, err := rpcRequest2XML("Some.Method", req)
 	if err != nil {
 		t.Error("RPC2XML conversion failed", err)
@@ -119,3 +127,539 @@ func TestRPC2XMLMuitiStruct(t *testing.T) {
 		t.Error("Got", xml)
 	}
 }
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode([]byte("you can't read this!")); err != nil {
+		t.Error("Encode failed", err)
+	}
+	if err := enc.EncodeRequest("Some.Method", &Service1Request{4, 2}); err != nil {
+		t.Error("EncodeRequest failed", err)
+	}
+	expected := "<value><base64>eW91IGNhbid0IHJlYWQgdGhpcyE=</base64></value>" +
+		"<methodCall><methodName>Some.Method</methodName><params><param><value><int>4</int></value></param><param><value><int>2</int></value></param></params></methodCall>"
+	if buf.String() != expected {
+		t.Error("Encoder failed")
+		t.Error("Expected", expected)
+		t.Error("Got", buf.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	err := NewEncoder(failingWriter{}).EncodeResponse("hello")
+	if err == nil || err.Error() != "broken pipe" {
+		t.Errorf("expected write error, but got: %v", err)
+	}
+}
+
+type StructTagsRPC2XML struct {
+	Name    string  `xmlrpc:"name"`
+	Comment string  `xmlrpc:"comment,omitempty"`
+	Owner   *string `xmlrpc:"owner,nil"`
+	Count   int     `xmlrpc:",nil"`
+	Cache   []byte  `xmlrpc:"-"`
+	Legacy  string  `xml:"legacy"`
+	private string
+}
+
+func TestRPC2XMLStructTags(t *testing.T) {
+	res := struct{ Tags StructTagsRPC2XML }{StructTagsRPC2XML{Name: "Johnny", Cache: []byte("x"), Legacy: "y", private: "z"}}
+	xml, err := rpcResponse2XML(res)
+	if err != nil {
+		t.Error("RPC2XML conversion failed", err)
+	}
+	expected := "<methodResponse><params><param><value><struct>" +
+		"<member><name>name</name><value><string>Johnny</string></value></member>" +
+		"<member><name>owner</name><value><nil/></value></member>" +
+		"<member><name>Count</name><value><nil/></value></member>" +
+		"<member><name>legacy</name><value><string>y</string></value></member>" +
+		"</struct></value></param></params></methodResponse>"
+	if xml != expected {
+		t.Error("RPC2XML struct tags conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", xml)
+	}
+}
+
+type StructNumbersRPC2XML struct {
+	Int8    int8
+	Int32   int32
+	Int     int
+	Int64   int64
+	Big     int64
+	Uint16  uint16
+	Uint32  uint32
+	Uint64  uint64
+	Float32 float32
+}
+
+func TestRPC2XMLNumbers(t *testing.T) {
+	req := &StructNumbersRPC2XML{-8, 32, 48, 64, 1 << 40, 16, 24, 1 << 35, 1.5}
+	xml, err := rpcResponse2XML(req)
+	if err != nil {
+		t.Error("RPC2XML conversion failed", err)
+	}
+	expected := "<methodResponse><params>" +
+		"<param><value><int>-8</int></value></param>" +
+		"<param><value><int>32</int></value></param>" +
+		"<param><value><int>48</int></value></param>" +
+		"<param><value><i8>64</i8></value></param>" +
+		"<param><value><i8>1099511627776</i8></value></param>" +
+		"<param><value><int>16</int></value></param>" +
+		"<param><value><i8>24</i8></value></param>" +
+		"<param><value><i8>34359738368</i8></value></param>" +
+		"<param><value><double>1.5</double></value></param>" +
+		"</params></methodResponse>"
+	if xml != expected {
+		t.Error("RPC2XML numbers conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", xml)
+	}
+}
+
+type mapKey struct {
+	ID int
+}
+
+func (k mapKey) MarshalText() ([]byte, error) {
+	return []byte("key" + strconv.Itoa(k.ID)), nil
+}
+
+func TestRPC2XMLMap(t *testing.T) {
+	req := map[string]interface{}{
+		"zeta":  1,
+		"alpha": "a",
+		"mid":   map[mapKey]bool{{2}: true, {1}: false},
+	}
+	xml, err := rpcResponse2XML(req)
+	if err != nil {
+		t.Error("RPC2XML conversion failed", err)
+	}
+	expected := "<methodResponse><params><param><value><struct>" +
+		"<member><name>alpha</name><value><string>a</string></value></member>" +
+		"<member><name>mid</name><value><struct>" +
+		"<member><name>key1</name><value><boolean>0</boolean></value></member>" +
+		"<member><name>key2</name><value><boolean>1</boolean></value></member>" +
+		"</struct></value></member>" +
+		"<member><name>zeta</name><value><int>1</int></value></member>" +
+		"</struct></value></param></params></methodResponse>"
+	if xml != expected {
+		t.Error("RPC2XML map conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", xml)
+	}
+
+	if _, err := rpcResponse2XML(map[int]string{1: "a"}); err == nil {
+		t.Error("expected error for unsupported map key type")
+	}
+}
+
+func TestRPC2XMLDateTime(t *testing.T) {
+	tm := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.FixedZone("", 2*60*60))
+
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	if err := encoder.Encode(tm); err != nil {
+		t.Error("Encode failed", err)
+	}
+	encoder.SetTimeLayout("2006-01-02T15:04:05Z07:00")
+	if err := encoder.Encode(tm); err != nil {
+		t.Error("Encode failed", err)
+	}
+	encoder.SetTimeLocation(nil)
+	if err := encoder.Encode(tm); err != nil {
+		t.Error("Encode failed", err)
+	}
+
+	expected := "<value><dateTime.iso8601>20240102T01:04:05</dateTime.iso8601></value>" +
+		"<value><dateTime.iso8601>2024-01-02T01:04:05Z</dateTime.iso8601></value>" +
+		"<value><dateTime.iso8601>2024-01-02T03:04:05+02:00</dateTime.iso8601></value>"
+	if buffer.String() != expected {
+		t.Error("Expected", expected)
+		t.Error("Got", buffer.String())
+	}
+}
+
+func TestRPC2XMLPointers(t *testing.T) {
+	name := "Johnny"
+	age := 33
+	type Nils struct {
+		Name  *string
+		Age   **int
+		Owner *Person
+		Tags  []string
+		Info  map[string]int
+		Any   interface{}
+	}
+	agePtr := &age
+	values := Nils{Name: &name, Age: &agePtr}
+
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	if err := encoder.Encode(values); err != nil {
+		t.Error("Encode failed", err)
+	}
+	encoder.SetNilPolicy(NilAsNil)
+	if err := encoder.Encode(values); err != nil {
+		t.Error("Encode failed", err)
+	}
+
+	expected := "<value><struct>" +
+		"<member><name>Name</name><value><string>Johnny</string></value></member>" +
+		"<member><name>Age</name><value><int>33</int></value></member>" +
+		"<member><name>Owner</name><value><nil/></value></member>" +
+		"<member><name>Tags</name><value><array><data></data></array></value></member>" +
+		"<member><name>Info</name><value><struct></struct></value></member>" +
+		"<member><name>Any</name><value><nil/></value></member>" +
+		"</struct></value>" +
+		"<value><struct>" +
+		"<member><name>Name</name><value><string>Johnny</string></value></member>" +
+		"<member><name>Age</name><value><int>33</int></value></member>" +
+		"<member><name>Owner</name><value><nil/></value></member>" +
+		"<member><name>Tags</name><value><nil/></value></member>" +
+		"<member><name>Info</name><value><nil/></value></member>" +
+		"<member><name>Any</name><value><nil/></value></member>" +
+		"</struct></value>"
+	if buffer.String() != expected {
+		t.Error("Expected", expected)
+		t.Error("Got", buffer.String())
+	}
+}
+
+type Blob []byte
+
+type ByteValues struct {
+	Blob  Blob
+	Pair  [2]byte
+	Bytes []uint8
+}
+
+func TestRPC2XMLBytes(t *testing.T) {
+	values := ByteValues{Blob("you"), [2]byte{'y', 'o'}, []uint8("you")}
+	data, err := Marshal(values)
+	if err != nil {
+		t.Fatal("Marshal failed", err)
+	}
+	expected := "<value><struct>" +
+		"<member><name>Blob</name><value><base64>eW91</base64></value></member>" +
+		"<member><name>Pair</name><value><base64>eW8=</base64></value></member>" +
+		"<member><name>Bytes</name><value><base64>eW91</base64></value></member>" +
+		"</struct></value>"
+	if string(data) != expected {
+		t.Error("Marshal failed")
+		t.Error("Expected", expected)
+		t.Error("Got", string(data))
+	}
+
+	var got ByteValues
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatal("Unmarshal failed", err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("Unmarshal failed: expected %v, got %v", values, got)
+	}
+	var triple [3]byte
+	if err := Unmarshal([]byte("<value><base64>eW8=</base64></value>"), &triple); err == nil {
+		t.Error("expected an error for a length mismatch")
+	}
+}
+
+type CyclicNode struct {
+	Name string
+	Next *CyclicNode
+}
+
+func TestRPC2XMLPointerCycle(t *testing.T) {
+	n := &CyclicNode{Name: "a"}
+	n.Next = &CyclicNode{Name: "b", Next: n}
+	_, err := Marshal(n)
+	uve, ok := err.(*UnsupportedValueError)
+	if !ok {
+		t.Fatal("expected error to be of concrete type UnsupportedValueError, but got", err)
+	}
+	if uve.Path != "CyclicNode.Next.Next" {
+		t.Errorf("expected the cycle at CyclicNode.Next.Next, got %s", uve.Path)
+	}
+
+	// A pointer shared by two fields isn't a cycle.
+	shared := &CyclicNode{Name: "c"}
+	if _, err := Marshal([]*CyclicNode{shared, shared}); err != nil {
+		t.Error("Expected err to be nil, but got:", err)
+	}
+}
+
+type UnsupportedItem struct {
+	Owner interface{}
+}
+
+type UnsupportedArgs struct {
+	Name  string
+	Items []UnsupportedItem
+}
+
+func TestRPC2XMLUnsupportedTypes(t *testing.T) {
+	items := make([]UnsupportedItem, 4)
+	items[3].Owner = func() {}
+	tests := []struct {
+		value interface{}
+		typ   string
+		path  string
+	}{
+		{make(chan int), "chan int", "params[0]"},
+		{complex(1, 2), "complex128", "params[0]"},
+		{map[int]string{1: "a"}, "map[int]string", "params[0]"},
+		{[]interface{}{1, map[string]interface{}{"a": make(chan bool)}}, "chan bool", `params[0][1]["a"]`},
+		{&UnsupportedArgs{"name", items}, "func()", "UnsupportedArgs.Items[3].Owner"},
+		{struct{ Values []complex64 }{[]complex64{1}}, "complex64", "Values[0]"},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		err := NewEncoder(&buffer).EncodeRequest("Some.Method", test.value)
+		ute, ok := err.(*UnsupportedTypeError)
+		if !ok {
+			t.Errorf("%T: expected UnsupportedTypeError, got %v", test.value, err)
+			continue
+		}
+		if ute.Type.String() != test.typ || ute.Path != test.path {
+			t.Errorf("%T: expected %s at %s, got %s at %s", test.value, test.typ, test.path, ute.Type, ute.Path)
+		}
+		if strings.Contains(buffer.String(), "</methodCall>") {
+			t.Errorf("%T: encoding should stop at the unsupported value: %s", test.value, buffer.String())
+		}
+	}
+
+	err := NewEncoder(new(bytes.Buffer)).Encode(UnsupportedItem{make(chan int)})
+	if err == nil || err.Error() != "xml: unsupported type chan int at UnsupportedItem.Owner" {
+		t.Error("wrong error:", err)
+	}
+	err = NewEncoder(new(bytes.Buffer)).Encode(make(chan int))
+	if err == nil || err.Error() != "xml: unsupported type: chan int" {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestRPC2XMLUnsupportedValues(t *testing.T) {
+	_, err := Marshal(struct{ A []uint64 }{[]uint64{math.MaxUint64}})
+	uve, ok := err.(*UnsupportedValueError)
+	if !ok {
+		t.Fatal("expected error to be of concrete type UnsupportedValueError, but got", err)
+	}
+	if uve.Str != "18446744073709551615" || uve.Path != "A[0]" {
+		t.Errorf("expected 18446744073709551615 at A[0], got %s at %s", uve.Str, uve.Path)
+	}
+}
+
+type SkippedParams struct {
+	Name    string
+	hidden  chan int
+	Ignored chan int `xmlrpc:"-"`
+	Count   int
+}
+
+func TestRPC2XMLSkippedParams(t *testing.T) {
+	xml, err := rpcRequest2XML("Some.Method", &SkippedParams{Name: "a", hidden: make(chan int), Count: 2})
+	if err != nil {
+		t.Fatal("RPC2XML conversion failed", err)
+	}
+	expected := "<methodCall><methodName>Some.Method</methodName><params>" +
+		"<param><value><string>a</string></value></param>" +
+		"<param><value><int>2</int></value></param>" +
+		"</params></methodCall>"
+	if xml != expected {
+		t.Error("RPC2XML skipped params conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", xml)
+	}
+
+	var got SkippedParams
+	if _, err := UnmarshalRequest([]byte(xml), &got); err != nil {
+		t.Fatal("Expected err to be nil, but got:", err)
+	}
+	if got.Name != "a" || got.Count != 2 {
+		t.Errorf("Wrong params: %+v", got)
+	}
+
+	// A time.Time is a single param, although a struct.
+	xml, err = rpcRequest2XML("Some.Method", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal("RPC2XML conversion failed", err)
+	}
+	if !strings.Contains(xml, "<params><param><value><dateTime.iso8601>20240102T03:04:05</dateTime.iso8601></value></param></params>") {
+		t.Error("Wrong time param:", xml)
+	}
+}
+
+type EscapedMembers struct {
+	Tag string `xmlrpc:"a<b&c"`
+}
+
+func TestRPC2XMLEscaping(t *testing.T) {
+	var buffer bytes.Buffer
+	err := NewEncoder(&buffer).EncodeRequest("Some.<Method>&", EscapedMembers{"x\r\n\"y\""}, map[string]int{"<k>": 1})
+	if err != nil {
+		t.Fatal("EncodeRequest failed", err)
+	}
+	expected := "<methodCall><methodName>Some.&lt;Method&gt;&amp;</methodName><params>" +
+		"<param><value><string>x&#xD;\n&quot;y&quot;</string></value></param>" +
+		"<param><value><struct><member><name>&lt;k&gt;</name><value><int>1</int></value></member></struct></value></param>" +
+		"</params></methodCall>"
+	if buffer.String() != expected {
+		t.Error("Expected", expected)
+		t.Error("Got", buffer.String())
+	}
+
+	var got struct {
+		Tag string `xmlrpc:"a<b&c"`
+	}
+	data, err := Marshal(EscapedMembers{"v"})
+	if err != nil {
+		t.Fatal("Marshal failed", err)
+	}
+	if err := Unmarshal(data, &got); err != nil || got.Tag != "v" {
+		t.Error("escaped member name should round-trip:", got.Tag, err)
+	}
+
+	tests := []struct {
+		policy InvalidCharPolicy
+		value  interface{}
+		out    string
+		err    string
+	}{
+		{RejectInvalidChars, "a\x01b", "", "xml: invalid character U+0001 at params[0]"},
+		{RejectInvalidChars, "a\xffb", "", "xml: invalid UTF-8 at params[0]"},
+		{RejectInvalidChars, map[string]int{"k\x1f": 1}, "", `xml: invalid character U+001F at params[0]["k\x1f"]`},
+		{RejectInvalidChars, struct{ Name string }{"\ufffe"}, "", "xml: invalid character U+FFFE at Name"},
+		{ReplaceInvalidChars, "a\x01b\xff\t", "<string>a\uFFFDb\uFFFD\t</string>", ""},
+		{StripInvalidChars, "a\x01b\xff\t", "<string>ab\t</string>", ""},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		encoder := NewEncoder(&buffer)
+		encoder.SetInvalidCharPolicy(test.policy)
+		err := encoder.EncodeRequest("Some.Method", test.value)
+		if test.err != "" {
+			if _, ok := err.(*InvalidCharError); !ok || err.Error() != test.err {
+				t.Errorf("%q: expected %q, got %v", test.value, test.err, err)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(buffer.String(), test.out) {
+			t.Errorf("%q: expected %s, got %s, %v", test.value, test.out, buffer.String(), err)
+		}
+	}
+
+	err = NewEncoder(new(bytes.Buffer)).EncodeRequest("Some\x00Method")
+	if err == nil || err.Error() != "xml: invalid character U+0000" {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestRPC2XMLFloats(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{1e-9, "<double>0.000000001</double>"},
+		{2.0, "<double>2.0</double>"},
+		{-0.1, "<double>-0.1</double>"},
+		{1e21, "<double>1000000000000000000000.0</double>"},
+		{float32(0.1), "<double>0.1</double>"},
+		{math.Copysign(0, -1), "<double>-0.0</double>"},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		if err := NewEncoder(&buffer).Encode(test.value); err != nil {
+			t.Errorf("%v: Encode failed: %v", test.value, err)
+			continue
+		}
+		if buffer.String() != "<value>"+test.expected+"</value>" {
+			t.Errorf("%v: expected %s, got %s", test.value, test.expected, buffer.String())
+		}
+	}
+
+	nonFinite := []struct {
+		value  float64
+		policy NonFinitePolicy
+		out    string
+		err    string
+	}{
+		{math.NaN(), RejectNonFinite, "", "xml: unsupported value NaN at params[0]"},
+		{math.Inf(-1), RejectNonFinite, "", "xml: unsupported value -Inf at params[0]"},
+		{math.NaN(), NonFiniteAsNil, "<value><nil/></value>", ""},
+		{math.NaN(), NonFiniteAsText, "<value><double>NaN</double></value>", ""},
+		{math.Inf(1), NonFiniteAsText, "<value><double>Infinity</double></value>", ""},
+		{math.Inf(-1), NonFiniteAsText, "<value><double>-Infinity</double></value>", ""},
+	}
+	for _, test := range nonFinite {
+		var buffer bytes.Buffer
+		encoder := NewEncoder(&buffer)
+		encoder.SetNonFinitePolicy(test.policy)
+		err := encoder.EncodeResponse(test.value)
+		if test.err != "" {
+			if _, ok := err.(*UnsupportedValueError); !ok || err.Error() != test.err {
+				t.Errorf("%v: expected %q, got %v", test.value, test.err, err)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(buffer.String(), test.out) {
+			t.Errorf("%v: expected %s, got %s, %v", test.value, test.out, buffer.String(), err)
+			continue
+		}
+		if test.policy == NonFiniteAsText {
+			var got float64
+			if err := UnmarshalResponse(buffer.Bytes(), &got); err != nil || strconv.FormatFloat(got, 'g', -1, 64) != strconv.FormatFloat(test.value, 'g', -1, 64) {
+				t.Errorf("%v: decoded as %v, %v", test.value, got, err)
+			}
+		}
+	}
+}
+
+// finiteFloats generates finite floats of every magnitude, from their bits.
+func finiteFloats(values []reflect.Value, r *rand.Rand) {
+	for i := range values {
+		for {
+			f := math.Float64frombits(r.Uint64())
+			if !math.IsNaN(f) && !math.IsInf(f, 0) {
+				values[i] = reflect.ValueOf(f)
+				break
+			}
+		}
+	}
+}
+
+func TestRPC2XMLFloatRoundTrip(t *testing.T) {
+	roundTrip := func(f float64) bool {
+		data, err := Marshal(f)
+		if err != nil {
+			return false
+		}
+		var got float64
+		return Unmarshal(data, &got) == nil && math.Float64bits(got) == math.Float64bits(f)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 10000, Values: finiteFloats}); err != nil {
+		t.Error(err)
+	}
+
+	roundTrip32 := func(bits uint32) bool {
+		f32 := math.Float32frombits(bits)
+		if math.IsNaN(float64(f32)) || math.IsInf(float64(f32), 0) {
+			return true
+		}
+		data, err := Marshal(f32)
+		if err != nil {
+			return false
+		}
+		var got float32
+		return Unmarshal(data, &got) == nil && math.Float32bits(got) == math.Float32bits(f32)
+	}
+	if err := quick.Check(roundTrip32, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -5,10 +5,12 @@
 package xml
 
 import (
+	"bytes"
 	"encoding/xml"
-	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/rpc"
 )
@@ -20,37 +22,98 @@ import (
 // NewCodec returns a new XML-RPC Codec.
 func NewCodec() *Codec {
 	return &Codec{
-		aliases: make(map[string]string),
+		aliases:    make(map[string]string),
+		methods:    make(map[string]*serviceMethod),
+		timeLayout: DateTimeLayout,
+		loc:        time.UTC,
 	}
 }
 
 // Codec creates a CodecRequest to process each request.
 type Codec struct {
-	aliases map[string]string
+	mu         sync.RWMutex // guards aliases, methods and mapper
+	aliases    map[string]string
+	methods    map[string]*serviceMethod
+	system     *systemService
+	mapper     MethodMapper
+	strict     bool
+	coercion   Coercion
+	extensions bool
+	timeLayout string
+	loc        *time.Location
 }
 
-// RegisterAlias creates a method alias
+// RegisterAlias creates a method alias. It may be called while the codec
+// serves requests.
 func (c *Codec) RegisterAlias(alias, method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.aliases[alias] = method
 }
 
+// SetStrict makes the codec decode requests strictly, see Decoder.SetStrict.
+// The method of a request it rejects isn't called.
+func (c *Codec) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// SetCoercion sets the type conversions made decoding requests, see
+// Decoder.SetCoercion.
+func (c *Codec) SetCoercion(coercion Coercion) {
+	c.coercion = coercion
+}
+
+// SetExtensions enables the Apache XML-RPC extension types, decoding requests
+// and encoding responses, see Decoder.SetExtensions and
+// Encoder.SetExtensions.
+func (c *Codec) SetExtensions(enabled bool) {
+	c.extensions = enabled
+}
+
+// SetTimeLayout sets the layout of the times of responses, see
+// Encoder.SetTimeLayout.
+func (c *Codec) SetTimeLayout(layout string) {
+	c.timeLayout = layout
+}
+
+// SetTimeLocation sets the location times of responses are converted to and
+// times of requests without offset are decoded in, see
+// Encoder.SetTimeLocation and Decoder.SetTimeLocation.
+func (c *Codec) SetTimeLocation(loc *time.Location) {
+	c.loc = loc
+}
+
 // NewRequest returns a CodecRequest.
 func (c *Codec) NewRequest(r *http.Request) rpc.CodecRequest {
-	rawxml, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return &CodecRequest{err: err}
-	}
 	defer r.Body.Close()
 
-	var request ServerRequest
-	if err := xml.Unmarshal(rawxml, &request); err != nil {
-		return &CodecRequest{err: err}
-	}
-	request.rawxml = string(rawxml)
-	if method, ok := c.aliases[request.Method]; ok {
-		request.Method = method
+	decoder := c.newDecoder(r.Body)
+	ret, err := decoder.readMessage()
+	if err != nil {
+		return &CodecRequest{codec: c, err: err}
 	}
-	return &CodecRequest{request: &request}
+
+	request := &ServerRequest{Method: c.resolve(ret.Method), params: ret.Params, decoder: decoder}
+	return &CodecRequest{codec: c, request: request}
+}
+
+// newDecoder returns a decoder of a request body, set up as the codec.
+func (c *Codec) newDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.SetStrict(c.strict)
+	d.SetCoercion(c.coercion)
+	d.SetExtensions(c.extensions)
+	d.SetTimeLocation(c.loc)
+	return d
+}
+
+// newEncoder returns an encoder of a response body, set up as the codec.
+func (c *Codec) newEncoder(w io.Writer) *Encoder {
+	e := NewEncoder(w)
+	e.SetExtensions(c.extensions)
+	e.SetTimeLayout(c.timeLayout)
+	e.SetTimeLocation(c.loc)
+	return e
 }
 
 // ----------------------------------------------------------------------------
@@ -61,11 +124,14 @@ func (c *Codec) NewRequest(r *http.Request) rpc.CodecRequest {
 type ServerRequest struct {
 	Name   xml.Name `xml:"methodCall"`
 	Method string   `xml:"methodName"`
-	rawxml string
+	params []param
+
+	decoder *Decoder
 }
 
 // CodecRequest decodes and encodes a single request.
 type CodecRequest struct {
+	codec   *Codec
 	request *ServerRequest
 	err     error
 }
@@ -84,32 +150,57 @@ func (c *CodecRequest) Method() (string, error) {
 //
 // args is the pointer to the Service.Args structure
 // it gets populated from temporary XML structure
+//
+// The params are rejected with a DecodeError, or a Fault, which gorilla/rpc
+// answers with a 400 Bad Request status instead of calling the method.
 func (c *CodecRequest) ReadRequest(args interface{}) error {
-	c.err = xml2RPC(c.request.rawxml, args)
-	return nil
+	if calls, ok := args.(*multicallArgs); ok {
+		calls.Calls, c.err = c.request.decoder.parseMulticall(c.request.params)
+		return c.err
+	}
+	c.err = c.request.decoder.params2RPC(c.request.params, args)
+	return c.err
 }
 
 // WriteResponse encodes the response and writes it to the ResponseWriter.
 //
 // response is the pointer to the Service.Response structure
-// it gets encoded into the XML-RPC xml string
+// it gets encoded into the XML-RPC xml string.
+// A non-nil methodErr is encoded as a fault instead: a Fault is sent as is,
+// any other error becomes FaultApplicationError with the error message.
 func (c *CodecRequest) WriteResponse(w http.ResponseWriter, response interface{}, methodErr error) error {
-	var xmlstr string
-	if c.err != nil {
-		var fault Fault
-		switch c.err.(type) {
-		case Fault:
-			fault = c.err.(Fault)
-		default:
-			fault = FaultApplicationError
-			fault.String += fmt.Sprintf(": %v", c.err)
-		}
-		xmlstr = fault2XML(fault)
-	} else {
-		xmlstr, _ = rpcResponse2XML(response)
+	err := c.err
+	if err == nil {
+		err = methodErr
 	}
+	writeResponse(w, c.codec.newEncoder, response, err)
+	return nil
+}
 
+// writeResponse writes response, or the fault of err if it's not nil, with
+// the encoders returned by newEncoder.
+func writeResponse(w http.ResponseWriter, newEncoder func(w io.Writer) *Encoder, response interface{}, err error) {
 	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
-	w.Write([]byte(xmlstr))
-	return nil
+	w.Write(encodeResponse(newEncoder, response, err))
+}
+
+// encodeResponse returns the encoding of response, or of the fault of err if
+// it's not nil, by the encoders returned by newEncoder.
+func encodeResponse(newEncoder func(w io.Writer) *Encoder, response interface{}, err error) []byte {
+	// The response is encoded in full first, so that a reply which can't be
+	// encoded is sent as a fault rather than as a truncated response.
+	var buffer bytes.Buffer
+	if err == nil {
+		if err = newEncoder(&buffer).EncodeResponse(response); err != nil {
+			buffer.Reset()
+		}
+	}
+	if err != nil {
+		// A fault is always sent, with any invalid character of its message
+		// replaced.
+		encoder := newEncoder(&buffer)
+		encoder.SetInvalidCharPolicy(ReplaceInvalidChars)
+		encoder.EncodeFault(toFault(err))
+	}
+	return buffer.Bytes()
 }
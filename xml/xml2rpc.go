@@ -5,10 +5,12 @@
 package xml
 
 import (
-	"bytes"
+	"bufio"
+	"encoding"
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
@@ -21,9 +23,272 @@ import (
 	_ "github.com/rogpeppe/go-charset/data"
 )
 
+// ----------------------------------------------------------------------------
+// Decoder
+// ----------------------------------------------------------------------------
+
+// Decoder reads XML-RPC values, requests and responses from an input stream.
+//
+// The input is parsed token by token as it's read, rather than being read
+// into memory first.
+type Decoder struct {
+	r          *errReader
+	d          *xml.Decoder
+	loc        *time.Location
+	extensions bool
+	strict     bool
+	coercion   Coercion
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	er := &errReader{r: bufio.NewReader(r), line: 1}
+	d := xml.NewDecoder(er)
+	d.CharsetReader = charset.NewReader
+	return &Decoder{r: er, d: d, loc: time.UTC}
+}
+
+// SetStrict makes the decoder reject struct members matching no field,
+// duplicate members, and missing members or params for fields tagged
+// required. By default, unknown and duplicate members are ignored, the last
+// one winning, and missing ones leave their field untouched.
+func (d *Decoder) SetStrict(strict bool) {
+	d.strict = strict
+}
+
+// SetTimeLocation sets the location of decoded dateTime.iso8601 values
+// without time zone offset. The default, also used for a nil loc, is
+// time.UTC. Values with an offset keep it.
+func (d *Decoder) SetTimeLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	d.loc = loc
+}
+
+// Decode reads the next <value> element and stores it in the value pointed
+// to by v.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xml: Decode(%T): v must be a non-nil pointer", v)
+	}
+
+	for {
+		token, err := d.d.Token()
+		if err != nil {
+			return d.readError(err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "value" {
+			return d.readError(fmt.Errorf("expected element <value> but have <%s>", start.Name.Local))
+		}
+
+		var val value
+		if err := d.d.DecodeElement(&val, &start); err != nil {
+			return d.readError(err)
+		}
+		elem := rv.Elem()
+		return d.value2Field(val, &elem)
+	}
+}
+
+// DecodeRequest reads a methodCall, stores its params in the value pointed
+// to by args and returns the method name. A nil args discards the params.
+func (d *Decoder) DecodeRequest(args interface{}) (string, error) {
+	if err := checkParamsTarget("DecodeRequest", args); err != nil {
+		return "", err
+	}
+	ret, err := d.readMessage()
+	if err != nil {
+		return "", err
+	}
+	return ret.Method, d.params2RPC(ret.Params, args)
+}
+
+// DecodeResponse reads a methodResponse and stores its params in the value
+// pointed to by reply. A fault response is returned as a Fault. A nil reply
+// discards the params.
+func (d *Decoder) DecodeResponse(reply interface{}) error {
+	if err := checkParamsTarget("DecodeResponse", reply); err != nil {
+		return err
+	}
+	ret, err := d.readMessage()
+	if err != nil {
+		return err
+	}
+
+	if !ret.Fault.IsEmpty() {
+		return getFaultResponse(ret.Fault)
+	}
+
+	return d.params2RPC(ret.Params, reply)
+}
+
+// checkParamsTarget returns the error of a call of fn with v, which must be
+// nil or a non-nil pointer.
+func checkParamsTarget(fn string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xml: %s(%T): nil or a non-nil pointer expected", fn, v)
+	}
+	return nil
+}
+
+// readMessage reads a methodCall or methodResponse into the temporal
+// structure.
+func (d *Decoder) readMessage() (*response, error) {
+	var ret response
+	if err := d.d.Decode(&ret); err != nil {
+		return nil, d.readError(err)
+	}
+	return &ret, nil
+}
+
+// readError returns the error reported when the input can't be decoded:
+// FaultSystemError if it couldn't be read, a DecodeError locating err
+// otherwise.
+func (d *Decoder) readError(err error) error {
+	if d.r.err != nil {
+		return FaultSystemError
+	}
+	return &DecodeError{Param: -1, Line: d.r.line, Column: d.r.column, Err: err}
+}
+
+// errReader records the first error of r other than io.EOF, to tell
+// failures to read the input from malformed input.
+//
+// It's an io.ByteReader, so that xml.Decoder reads it byte by byte rather
+// than through a buffer of its own, and it keeps track of the line and
+// column of the last byte read.
+type errReader struct {
+	r      *bufio.Reader
+	err    error
+	line   int
+	column int
+}
+
+func (r *errReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		r.record(err)
+		return b, err
+	}
+	if b == '\n' {
+		r.line++
+		r.column = 0
+	} else {
+		r.column++
+	}
+	return b, nil
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for _, b := range p[:n] {
+		if b == '\n' {
+			r.line++
+			r.column = 0
+		} else {
+			r.column++
+		}
+	}
+	r.record(err)
+	return n, err
+}
+
+func (r *errReader) record(err error) {
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+}
+
+// DecodeError describes a value or an input that couldn't be decoded.
+type DecodeError struct {
+	// Param is the index of the param holding the value, or -1 for the
+	// value read by Decode and for malformed input.
+	Param int
+	// Path locates the value within the param, through the names of the
+	// struct members and the indexes of the array items holding it, e.g.
+	// .items[3].owner.
+	Path string
+	// Type is the XML-RPC type of the value, and Value its text.
+	Type  string
+	Value string
+	// GoType is the Go type the value was decoded into, and Expected the
+	// XML-RPC type it's encoded as.
+	GoType   reflect.Type
+	Expected string
+	// Line and Column locate malformed input, and are 0 otherwise.
+	Line   int
+	Column int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.GoType == nil {
+		return fmt.Sprintf("xml: line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	typ := e.Type
+	if typ == "" {
+		typ = "string"
+	}
+	return fmt.Sprintf("xml: cannot decode <%s> %q into %s (<%s>) at %s: %v",
+		typ, e.Value, e.GoType, e.Expected, e.location(), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// location returns the path of the value, including the param.
+func (e *DecodeError) location() string {
+	if e.Param >= 0 {
+		return fmt.Sprintf("params[%d]%s", e.Param, e.Path)
+	}
+	if e.Path == "" {
+		return "value"
+	}
+	return "value" + e.Path
+}
+
+// fault returns the fault sent for e: FaultDecode for malformed input,
+// otherwise the fault of the underlying error, FaultInvalidParams if it
+// isn't a Fault, followed by the location of the value.
+func (e *DecodeError) fault() Fault {
+	if e.GoType == nil {
+		fault := FaultDecode
+		fault.String += fmt.Sprintf(": line %d, column %d: %v", e.Line, e.Column, e.Err)
+		return fault
+	}
+	fault, ok := e.Err.(Fault)
+	if !ok {
+		fault = FaultInvalidParams
+		fault.String += fmt.Sprintf(": %v", e.Err)
+	}
+	fault.String += " at " + e.location()
+	return fault
+}
+
+// decodePath prefixes the path of err with prefix, if err is a DecodeError.
+func decodePath(err error, prefix string) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Path = prefix + de.Path
+	}
+	return err
+}
+
 // Types used for unmarshalling
 type response struct {
 	Name   xml.Name   `xml:"methodResponse"`
+	Method string     `xml:"methodName"`
 	Params []param    `xml:"params>param"`
 	Fault  faultValue `xml:"fault,omitempty"`
 }
@@ -33,16 +298,15 @@ type param struct {
 }
 
 type value struct {
-	Array    []value  `xml:"array>data>value"`
-	Struct   []member `xml:"struct>member"`
-	String   string   `xml:"string"`
-	Int      string   `xml:"int"`
-	Int4     string   `xml:"i4"`
-	Double   string   `xml:"double"`
-	Boolean  string   `xml:"boolean"`
-	DateTime string   `xml:"dateTime.iso8601"`
-	Base64   string   `xml:"base64"`
-	Raw      string   `xml:",innerxml"` // the value can be defualt string
+	Type   string // name of the type element, with an ex: prefix for the extensions, empty for a bare string
+	Text   string // character data of a scalar value
+	Array  []value
+	Struct []member
+}
+
+// isNil reports whether v is <nil/> or <ex:nil/>.
+func (v value) isNil() bool {
+	return v.Type == "nil" || v.Type == "ex:nil"
 }
 
 type member struct {
@@ -50,41 +314,118 @@ type member struct {
 	Value value  `xml:"value"`
 }
 
-func xml2RPC(xmlraw string, rpc interface{}) error {
-	// Unmarshal raw XML into the temporal structure
-	var ret response
-	decoder := xml.NewDecoder(bytes.NewReader([]byte(xmlraw)))
-	decoder.CharsetReader = charset.NewReader
-	err := decoder.Decode(&ret)
-	if err != nil {
-		return FaultDecode
+// UnmarshalXML reads a <value> element token by token, so that only the
+// data of each value is kept rather than the inner XML at every level.
+func (v *value) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var text []byte
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if v.Type != "" {
+				return fmt.Errorf("xml: <value> holds both <%s> and <%s>", v.Type, t.Name.Local)
+			}
+			v.Type = t.Name.Local
+			if isExtension(t.Name.Space) {
+				v.Type = "ex:" + v.Type
+			}
+			switch v.Type {
+			case "array":
+				var array struct {
+					Data []value `xml:"data>value"`
+				}
+				err = d.DecodeElement(&array, &t)
+				v.Array = array.Data
+			case "struct":
+				var s struct {
+					Members []member `xml:"member"`
+				}
+				err = d.DecodeElement(&s, &t)
+				v.Struct = s.Members
+			default:
+				err = d.DecodeElement(&v.Text, &t)
+			}
+			if err != nil {
+				return err
+			}
+		case xml.CharData:
+			if v.Type == "" {
+				text = append(text, t...)
+			}
+		case xml.EndElement:
+			// value field is default to string, see http://en.wikipedia.org/wiki/XML-RPC#Data_types
+			if v.Type == "" {
+				v.Text = strings.TrimSpace(string(text))
+			}
+			return nil
+		}
 	}
+}
 
-	if !ret.Fault.IsEmpty() {
-		return getFaultResponse(ret.Fault)
-	}
+func xml2RPC(xmlraw string, rpc interface{}) error {
+	return NewDecoder(strings.NewReader(xmlraw)).DecodeResponse(rpc)
+}
 
+// params2RPC converts params into the passed rpc variable, according to
+// it's structure.
+func (d *Decoder) params2RPC(params []param, rpc interface{}) error {
+	if rpc == nil {
+		return nil
+	}
 	typ := reflect.TypeOf(rpc).Elem()
 
+	// Anything but a structure holds a single param
+	if typ.Kind() != reflect.Struct || singleParam(typ) {
+		if len(params) > 1 {
+			return FaultWrongArgumentsNumber
+		}
+		if len(params) == 0 {
+			return nil
+		}
+		elem := reflect.ValueOf(rpc).Elem()
+		return paramError(d.value2Field(params[0].Value, &elem), 0)
+	}
+
 	// Structures should have equal number of fields
-	if typ.NumField() < len(ret.Params) {
+	fields := structFields(typ)
+	if len(fields) < len(params) {
 		return FaultWrongArgumentsNumber
 	}
 
 	// Now, convert temporal structure into the
 	// passed rpc variable, according to it's structure
 	elem := reflect.ValueOf(rpc).Elem()
-	for i, param := range ret.Params {
-		field := elem.Field(i)
-		err = value2Field(param.Value, &field)
+	for i, param := range params {
+		field := elem.FieldByIndex(fields[i].index)
+		err := d.value2Field(param.Value, &field)
 		if err != nil {
-			return err
+			return paramError(err, i)
+		}
+	}
+
+	// A strict decoder rejects missing params for fields tagged required.
+	if d.strict {
+		for i := len(params); i < len(fields); i++ {
+			if fields[i].required {
+				return strictFault("missing required param %d (%s)", i, typ.FieldByIndex(fields[i].index).Name)
+			}
 		}
 	}
 
 	return nil
 }
 
+// paramError sets the param index of err, if it's a DecodeError.
+func paramError(err error, i int) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Param = i
+	}
+	return err
+}
+
 // getFaultResponse converts faultValue to Fault.
 func getFaultResponse(fault faultValue) Fault {
 	var (
@@ -94,130 +435,475 @@ func getFaultResponse(fault faultValue) Fault {
 
 	for _, field := range fault.Value.Struct {
 		if field.Name == "faultCode" {
-			code, _ = strconv.Atoi(field.Value.Int)
+			code, _ = strconv.Atoi(field.Value.Text)
 		} else if field.Name == "faultString" {
-			str = field.Value.String
-			if str == "" {
-				str = field.Value.Raw
-			}
+			str = field.Value.Text
 		}
 	}
 
 	return Fault{Code: code, String: str}
 }
 
-func value2Field(value value, field *reflect.Value) error {
+// value2Field decodes value into field. A failure is returned as a
+// DecodeError, located at value; the callers prefix its path.
+func (d *Decoder) value2Field(value value, field *reflect.Value) error {
+	err := d.decodeValue(value, field)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{
+		Param:    -1,
+		Type:     value.Type,
+		Value:    value.Text,
+		GoType:   field.Type(),
+		Expected: xmlrpcType(field.Type()),
+		Err:      err,
+	}
+}
+
+func (d *Decoder) decodeValue(value value, field *reflect.Value) error {
 	if !field.CanSet() {
 		return FaultApplicationError
 	}
 
+	if err := d.checkExtension(value.Type); err != nil {
+		return err
+	}
+
+	if field.Kind() == reflect.Interface && field.NumMethod() == 0 {
+		return d.value2Interface(value, field)
+	}
+
+	// *big.Int and *big.Float are decoded straight from <ex:biginteger>
+	// and <ex:bigdecimal>, see bigInt2Field and bigFloat2Field.
+	if field.Kind() == reflect.Ptr && (value.isNil() || field.Type() != typeOfBigInt && field.Type() != typeOfBigFloat) {
+		return d.value2Pointer(value, field)
+	}
+
+	if ok, err := d.unmarshalValue(value, field); ok {
+		return err
+	}
+	if ok, err := d.coerce(value, field); ok {
+		return err
+	}
+
 	var (
 		err error
 		val interface{}
 	)
 
-	switch {
-	case value.Int != "":
-		val, _ = strconv.Atoi(value.Int)
-	case value.Int4 != "":
-		val, _ = strconv.Atoi(value.Int4)
-	case value.Double != "":
-		val, _ = strconv.ParseFloat(value.Double, 64)
-	case value.String != "":
-		val = value.String
-	case value.Boolean != "":
-		val = xml2Bool(value.Boolean)
-	case value.DateTime != "":
-		val, err = xml2DateTime(value.DateTime)
-	case value.Base64 != "":
-		val, err = xml2Base64(value.Base64)
-	case len(value.Struct) != 0:
+	switch value.Type {
+	case "int", "i4", "i8", "ex:i1", "ex:i2", "ex:i8":
+		i, err := strconv.ParseInt(strings.TrimSpace(value.Text), 10, 64)
+		if err != nil {
+			return err
+		}
+		return int2Field(i, field)
+	case "double", "ex:float":
+		text := strings.TrimSpace(value.Text)
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		if field.Kind() == reflect.Float32 && !field.OverflowFloat(f) {
+			// Round the text once, rather than through a float64, so that a
+			// float32 encoded with its fewest digits decodes back to itself.
+			f, _ = strconv.ParseFloat(text, 32)
+		}
+		return float2Field(f, field)
+	case "ex:biginteger":
+		return bigInt2Field(value.Text, field)
+	case "ex:bigdecimal":
+		return bigFloat2Field(value.Text, field)
+	case "boolean":
+		val, err = xml2Bool(value.Text)
+	case "dateTime.iso8601", "ex:dateTime":
+		val, err = d.xml2DateTime(value.Text)
+	case "base64":
+		var data []byte
+		if data, err = xml2Base64(value.Text); err == nil && isBytes(field.Type()) {
+			return bytes2Field(data, field)
+		}
+		val = data
+	case "struct":
+		if field.Kind() == reflect.Map {
+			return d.struct2Map(value.Struct, field)
+		}
 		if field.Kind() != reflect.Struct {
 			fault := FaultInvalidParams
-			fault.String += fmt.Sprintf("structure fields mismatch: %s != %s", field.Kind(), reflect.Struct.String())
+			fault.String += fmt.Sprintf(": structure fields mismatch: %s != %s", field.Kind(), reflect.Struct.String())
 			return fault
 		}
-		s := value.Struct
-		for i := 0; i < len(s); i++ {
-			// Uppercase first letter for field name to deal with
-			// methods in lowercase, which cannot be used
-			fieldName := captionString(s[i].Name)
-			f := field.FieldByName(fieldName)
-			if !f.CanSet() {
-				excepted := strings.ToLower(s[i].Name)
-				f = field.FieldByNameFunc(func(s string) bool {
-					if strings.ToLower(s) == excepted {
-						return unicode.IsUpper(rune(s[0]))
-					}
-					return false
-				})
-			}
-			err = value2Field(s[i].Value, &f)
-		}
-	case len(value.Array) == 0:
-	case len(value.Array) != 0:
-		a := value.Array
-		f := *field
-		slice := reflect.MakeSlice(reflect.TypeOf(f.Interface()),
-			len(a), len(a))
-		for i := 0; i < len(a); i++ {
-			item := slice.Index(i)
-			err = value2Field(a[i], &item)
-		}
-		f = reflect.AppendSlice(f, slice)
-		val = f.Interface()
-	case len(value.Array) == 0:
-		val = val
-
-	default:
-		// value field is default to string, see http://en.wikipedia.org/wiki/XML-RPC#Data_types
-		// also can be <nil/>
-		if value.Raw != "<nil/>" {
-			v := value.Raw
-			v = strings.TrimSpace(v)
-			if v == "<string></string>" {
-				v = ""
-			}
-			val = v
+		return d.struct2Struct(value.Struct, field)
+	case "array":
+		return d.array2Field(value.Array, field)
+	case "nil", "ex:nil":
+		switch field.Kind() {
+		case reflect.Map, reflect.Slice:
+			field.Set(reflect.Zero(field.Type()))
 		}
+	default:
+		// "string" or a bare string
+		val = value.Text
 	}
 
+	if err != nil {
+		return err
+	}
 	if val != nil {
 		if reflect.TypeOf(val) != reflect.TypeOf(field.Interface()) {
+			return typeMismatch(reflect.TypeOf(val), field.Type())
+		}
+
+		field.Set(reflect.ValueOf(val))
+	}
+
+	return nil
+}
+
+// bytes2Field stores data into a field of a type isBytes reports. An array
+// field must have the length of data.
+func bytes2Field(data []byte, field *reflect.Value) error {
+	if field.Kind() == reflect.Slice {
+		field.SetBytes(data)
+		return nil
+	}
+	if field.Len() != len(data) {
+		fault := FaultInvalidParams
+		fault.String += fmt.Sprintf(": array length mismatch: %d != %d", len(data), field.Len())
+		return fault
+	}
+	for i, b := range data {
+		field.Index(i).SetUint(uint64(b))
+	}
+	return nil
+}
+
+// array2Field stores the values of an array into a slice or an array field,
+// replacing its content: an empty array resets a slice to an empty one. An
+// array field must have the length of the array. The field is left untouched
+// if a value fails to decode.
+func (d *Decoder) array2Field(values []value, field *reflect.Value) error {
+	var array reflect.Value
+	switch field.Kind() {
+	case reflect.Slice:
+		array = reflect.MakeSlice(field.Type(), len(values), len(values))
+	case reflect.Array:
+		if field.Len() != len(values) {
 			fault := FaultInvalidParams
-			fault.String += fmt.Sprintf(": fields type mismatch: %s != %s",
-				reflect.TypeOf(val),
-				reflect.TypeOf(field.Interface()))
+			fault.String += fmt.Sprintf(": array length mismatch: %d != %d", len(values), field.Len())
 			return fault
 		}
+		array = reflect.New(field.Type()).Elem()
+	default:
+		fault := FaultInvalidParams
+		fault.String += fmt.Sprintf(": array fields mismatch: %s != %s", field.Kind(), reflect.Array)
+		return fault
+	}
 
-		field.Set(reflect.ValueOf(val))
+	for i := range values {
+		item := array.Index(i)
+		if err := d.value2Field(values[i], &item); err != nil {
+			return decodePath(err, fmt.Sprintf("[%d]", i))
+		}
 	}
+	field.Set(array)
+	return nil
+}
 
-	return err
+// struct2Struct stores the members of a struct into the fields of a struct
+// field. Members matching no field are skipped, unless the decoder is
+// strict: it then rejects them, as well as duplicate members and missing
+// members for fields tagged required.
+func (d *Decoder) struct2Struct(members []member, field *reflect.Value) error {
+	typ := field.Type()
+	seen := make(map[string]bool, len(members))
+	decoded := make(map[string]bool, len(members))
+	for _, m := range members {
+		if d.strict && seen[m.Name] {
+			return strictFault("duplicate member %q", m.Name)
+		}
+		seen[m.Name] = true
+
+		fi, ok := fieldByMember(typ, m.Name)
+		if !ok {
+			if d.strict {
+				return strictFault("unknown member %q", m.Name)
+			}
+			continue
+		}
+		decoded[fmt.Sprint(fi.index)] = true
+		f := field.FieldByIndex(fi.index)
+		if fi.nilZero && m.Value.isNil() {
+			f.Set(reflect.Zero(f.Type()))
+			continue
+		}
+		if err := d.value2Field(m.Value, &f); err != nil {
+			return decodePath(err, "."+m.Name)
+		}
+	}
+
+	if d.strict {
+		for _, fi := range structFields(typ) {
+			if fi.required && !decoded[fmt.Sprint(fi.index)] {
+				return strictFault("missing required member %q", fi.name)
+			}
+		}
+	}
+	return nil
 }
 
-func xml2Bool(value string) bool {
-	var b bool
-	switch value {
+// strictFault returns the fault of a value rejected by a strict decoder.
+func strictFault(format string, args ...interface{}) Fault {
+	fault := FaultInvalidParams
+	fault.String += ": " + fmt.Sprintf(format, args...)
+	return fault
+}
+
+// value2Pointer sets a pointer field to nil for a nil value. Otherwise, it
+// decodes value into the value the field points to, allocating it if the
+// field is nil.
+func (d *Decoder) value2Pointer(value value, field *reflect.Value) error {
+	if value.isNil() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.IsNil() {
+		field.Set(reflect.New(field.Type().Elem()))
+	}
+	elem := field.Elem()
+	return d.value2Field(value, &elem)
+}
+
+// unmarshalValue decodes value into field if field is an Unmarshaler or an
+// encoding.TextUnmarshaler, and reports whether it is.
+func (d *Decoder) unmarshalValue(value value, field *reflect.Value) (bool, error) {
+	if !field.CanAddr() {
+		return false, nil
+	}
+	ptr := field.Addr()
+	switch {
+	case ptr.Type().Implements(typeOfUnmarshaler):
+		return true, ptr.Interface().(Unmarshaler).UnmarshalXMLRPC(func(v interface{}) error {
+			val := reflect.ValueOf(v)
+			if val.Kind() != reflect.Ptr || val.IsNil() {
+				return fmt.Errorf("xml: unmarshal into non-pointer %T", v)
+			}
+			elem := val.Elem()
+			return d.value2Field(value, &elem)
+		})
+	case field.Type() != typeOfTime && ptr.Type().Implements(typeOfTextUnmarshaler):
+		var text string
+		elem := reflect.ValueOf(&text).Elem()
+		if value.Type == "ex:biginteger" || value.Type == "ex:bigdecimal" {
+			// big.Int and big.Float are TextUnmarshalers of the same text.
+			text = value.Text
+		} else if err := d.value2Field(value, &elem); err != nil {
+			return true, err
+		}
+		return true, ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	return false, nil
+}
+
+// value2Interface stores value into an interface{} field, as the natural
+// Go type of its XML-RPC type: int, int64, float64, bool, string, time.Time,
+// []byte, map[string]interface{}, []interface{} or nil.
+func (d *Decoder) value2Interface(value value, field *reflect.Value) error {
+	var typ reflect.Type
+	switch value.Type {
+	case "int", "i4":
+		typ = reflect.TypeOf(int(0))
+	case "ex:i1":
+		typ = reflect.TypeOf(int8(0))
+	case "ex:i2":
+		typ = reflect.TypeOf(int16(0))
+	case "i8", "ex:i8":
+		typ = reflect.TypeOf(int64(0))
+	case "double":
+		typ = reflect.TypeOf(float64(0))
+	case "ex:float":
+		typ = reflect.TypeOf(float32(0))
+	case "ex:biginteger":
+		typ = typeOfBigInt
+	case "ex:bigdecimal":
+		typ = typeOfBigFloat
+	case "boolean":
+		typ = reflect.TypeOf(false)
+	case "dateTime.iso8601", "ex:dateTime":
+		typ = typeOfTime
+	case "base64":
+		typ = reflect.TypeOf([]byte(nil))
+	case "struct":
+		typ = reflect.TypeOf(map[string]interface{}(nil))
+	case "array":
+		typ = reflect.TypeOf([]interface{}(nil))
+	case "nil", "ex:nil":
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	default:
+		typ = reflect.TypeOf("")
+	}
+
+	val := reflect.New(typ).Elem()
+	if err := d.value2Field(value, &val); err != nil {
+		return err
+	}
+	field.Set(val)
+	return nil
+}
+
+// struct2Map stores the members of a struct into a map field with string
+// keys, allocating the map if needed.
+func (d *Decoder) struct2Map(members []member, field *reflect.Value) error {
+	typ := field.Type()
+	if typ.Key().Kind() != reflect.String {
+		return typeMismatch(reflect.TypeOf(map[string]interface{}(nil)), typ)
+	}
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(typ))
+	}
+	if d.strict {
+		seen := make(map[string]bool, len(members))
+		for _, m := range members {
+			if seen[m.Name] {
+				return strictFault("duplicate member %q", m.Name)
+			}
+			seen[m.Name] = true
+		}
+	}
+	for _, m := range members {
+		elem := reflect.New(typ.Elem()).Elem()
+		if err := d.value2Field(m.Value, &elem); err != nil {
+			return decodePath(err, "."+m.Name)
+		}
+		field.SetMapIndex(reflect.ValueOf(m.Name).Convert(typ.Key()), elem)
+	}
+	return nil
+}
+
+// int2Field stores i into a field of any integer kind, checking it fits.
+func int2Field(i int64, field *reflect.Value) error {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.OverflowInt(i) {
+			return outOfRange(i, field.Type())
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i < 0 || field.OverflowUint(uint64(i)) {
+			return outOfRange(i, field.Type())
+		}
+		field.SetUint(uint64(i))
+	default:
+		return typeMismatch(reflect.TypeOf(i), field.Type())
+	}
+	return nil
+}
+
+// float2Field stores f into a field of any float kind, checking it fits.
+func float2Field(f float64, field *reflect.Value) error {
+	switch field.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if field.OverflowFloat(f) {
+			return outOfRange(f, field.Type())
+		}
+		field.SetFloat(f)
+	default:
+		return typeMismatch(reflect.TypeOf(f), field.Type())
+	}
+	return nil
+}
+
+func typeMismatch(val, field reflect.Type) Fault {
+	fault := FaultInvalidParams
+	fault.String += fmt.Sprintf(": fields type mismatch: %s != %s", val, field)
+	return fault
+}
+
+func outOfRange(val interface{}, field reflect.Type) Fault {
+	fault := FaultInvalidParams
+	fault.String += fmt.Sprintf(": value %v out of range for %s", val, field)
+	return fault
+}
+
+func xml2Bool(value string) (bool, error) {
+	switch strings.TrimSpace(value) {
 	case "1", "true", "TRUE", "True":
-		b = true
+		return true, nil
 	case "0", "false", "FALSE", "False":
-		b = false
+		return false, nil
 	}
-	return b
+	return false, fmt.Errorf("invalid boolean %q", value)
 }
 
-func xml2DateTime(value string) (time.Time, error) {
-	var (
-		year, month, day     int
-		hour, minute, second int
-	)
-	_, err := fmt.Sscanf(value, "%04d%02d%02dT%02d:%02d:%02d",
-		&year, &month, &day,
-		&hour, &minute, &second)
-	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
-	return t, err
+// xml2DateTime parses a dateTime.iso8601 value. Besides the XML-RPC format,
+// 20060102T15:04:05, it accepts the common ISO 8601 variants: dashes in the
+// date, no colons in the time, fractional seconds and a Z or ±hh:mm offset.
+func (d *Decoder) xml2DateTime(value string) (time.Time, error) {
+	s := strings.TrimSpace(value)
+	t := strings.IndexByte(s, 'T')
+	if t < 0 {
+		return time.Time{}, fmt.Errorf("xml: invalid dateTime.iso8601 %q", value)
+	}
+	date, clock := strings.Replace(s[:t], "-", "", -1), s[t+1:]
+
+	loc := d.loc
+	if i := strings.IndexAny(clock, "Z+-"); i >= 0 {
+		zone, ok := parseZone(clock[i:])
+		if !ok {
+			return time.Time{}, fmt.Errorf("xml: invalid dateTime.iso8601 %q", value)
+		}
+		loc, clock = zone, clock[:i]
+	}
+	clock = strings.Replace(clock, ":", "", -1)
+	clock = strings.Replace(clock, ",", ".", 1)
+
+	// Parsing accepts fractional seconds after the seconds field, even
+	// though the layout doesn't have them.
+	tm, err := time.ParseInLocation("20060102T150405", date+"T"+clock, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("xml: invalid dateTime.iso8601 %q", value)
+	}
+	return tm, nil
+}
+
+// parseZone parses a Z, ±hh:mm, ±hhmm or ±hh time zone offset, of at most 23
+// hours and 59 minutes.
+func parseZone(zone string) (*time.Location, bool) {
+	if zone == "Z" {
+		return time.UTC, true
+	}
+	digits := strings.Replace(zone[1:], ":", "", 1)
+	if len(digits) != 2 && len(digits) != 4 {
+		return nil, false
+	}
+	offset := 0
+	for i, max := range []int{23, 59}[:len(digits)/2] {
+		d := digits[2*i : 2*i+2]
+		if d[0] < '0' || d[0] > '9' || d[1] < '0' || d[1] > '9' {
+			return nil, false
+		}
+		n := int(d[0]-'0')*10 + int(d[1]-'0')
+		if n > max {
+			return nil, false
+		}
+		offset = offset*60 + n
+	}
+	offset *= 60
+	if len(digits) == 2 {
+		offset *= 60
+	}
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	if offset == 0 {
+		return time.UTC, true
+	}
+	return time.FixedZone("", offset), true
 }
 
 func xml2Base64(value string) ([]byte, error) {
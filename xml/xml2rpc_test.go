@@ -5,7 +5,12 @@
 package xml
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,7 +37,7 @@ func TestXML2RPC(t *testing.T) {
 	if err != nil {
 		t.Error("XML2RPC conversion failed", err)
 	}
-	expectedReq := &StructXML2RPC{123, 3.145926, "Hello, World!", false, SubStructXML2RPC{42, "I'm Bar", []int{1, 2, 3}}, time.Date(2012, time.July, 17, 14, 8, 55, 0, time.Local), []byte("you can't read this!")}
+	expectedReq := &StructXML2RPC{123, 3.145926, "Hello, World!", false, SubStructXML2RPC{42, "I'm Bar", []int{1, 2, 3}}, time.Date(2012, time.July, 17, 14, 8, 55, 0, time.UTC), []byte("you can't read this!")}
 	if !reflect.DeepEqual(req, expectedReq) {
 		t.Error("XML2RPC conversion failed")
 		t.Error("Expected", expectedReq)
@@ -323,3 +328,479 @@ Requiredattribute'user'notfound:
 		}
 	}
 }
+
+func TestDecoder(t *testing.T) {
+	data := bytes.Repeat([]byte("large payload "), 100000)
+	r, w := io.Pipe()
+	go func() {
+		enc := NewEncoder(w)
+		enc.Encode(data)
+		enc.EncodeResponse(&Service1Response{42})
+		w.Close()
+	}()
+
+	dec := NewDecoder(r)
+	var got []byte
+	if err := dec.Decode(&got); err != nil {
+		t.Error("Decode failed", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Decode failed: got %d bytes", len(got))
+	}
+	var res Service1Response
+	if err := dec.DecodeResponse(&res); err != nil {
+		t.Error("DecodeResponse failed", err)
+	}
+	if res.Result != 42 {
+		t.Errorf("Wrong response: %v.", res.Result)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestDecoderReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("<methodResponse><params>"), failingReader{})
+	var res Service1Response
+	if err := NewDecoder(r).DecodeResponse(&res); err != FaultSystemError {
+		t.Errorf("expected FaultSystemError, but got: %v", err)
+	}
+	if err := NewDecoder(strings.NewReader("<methodResponse><params>")).DecodeResponse(&res); toFault(err).Code != FaultDecode.Code {
+		t.Errorf("expected FaultDecode, but got: %v", err)
+	}
+}
+
+type StructTagsXML2RPC struct {
+	Name    string `xmlrpc:"user_name"`
+	Count   int    `xmlrpc:"count,nil"`
+	Cache   string `xmlrpc:"-"`
+	Comment string
+}
+
+func TestXML2RPCStructTags(t *testing.T) {
+	req := &struct{ Tags StructTagsXML2RPC }{StructTagsXML2RPC{Count: 5, Cache: "kept"}}
+	err := xml2RPC("<methodResponse><params><param><value><struct>"+
+		"<member><name>user_name</name><value><string>Johnny</string></value></member>"+
+		"<member><name>count</name><value><nil/></value></member>"+
+		"<member><name>cache</name><value><string>overwritten</string></value></member>"+
+		"<member><name>comment</name><value><string>hello</string></value></member>"+
+		"</struct></value></param></params></methodResponse>", req)
+	if err != nil {
+		t.Error("XML2RPC conversion failed", err)
+	}
+	expected := StructTagsXML2RPC{Name: "Johnny", Cache: "kept", Comment: "hello"}
+	if req.Tags != expected {
+		t.Error("XML2RPC struct tags conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", req.Tags)
+	}
+}
+
+type EmbeddedXML2RPC struct {
+	X int
+}
+
+type OuterXML2RPC struct {
+	*EmbeddedXML2RPC
+	Y int
+}
+
+func TestXML2RPCStructTagsOnly(t *testing.T) {
+	var tags StructTagsXML2RPC
+	err := Unmarshal([]byte("<value><struct><member><name>Name</name><value>Johnny</value></member></struct></value>"), &tags)
+	if err != nil || tags.Name != "" {
+		t.Errorf("a tagged field should only match its tag: %q, %v", tags.Name, err)
+	}
+	decoder := NewDecoder(strings.NewReader("<value><struct><member><name>Name</name><value>Johnny</value></member></struct></value>"))
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&tags); err == nil || !strings.Contains(err.Error(), `unknown member "Name"`) {
+		t.Error("expected an unknown member error, got", err)
+	}
+
+	// Fields promoted through an embedded pointer aren't matched, so that a
+	// nil pointer can't be dereferenced.
+	var outer OuterXML2RPC
+	err = Unmarshal([]byte("<value><struct>"+
+		"<member><name>X</name><value><int>1</int></value></member>"+
+		"<member><name>Y</name><value><int>2</int></value></member>"+
+		"</struct></value>"), &outer)
+	if err != nil || outer.Y != 2 || outer.EmbeddedXML2RPC != nil {
+		t.Errorf("wrong decoding of promoted fields: %+v, %v", outer, err)
+	}
+	err = Unmarshal([]byte("<value><struct>"+
+		"<member><name>EmbeddedXML2RPC</name><value><struct><member><name>X</name><value><int>1</int></value></member></struct></value></member>"+
+		"</struct></value>"), &outer)
+	if err != nil || outer.EmbeddedXML2RPC == nil || outer.X != 1 {
+		t.Errorf("wrong decoding of the embedded struct: %+v, %v", outer, err)
+	}
+}
+
+type StructNumbersXML2RPC struct {
+	Int8    int8
+	Int64   int64
+	Uint16  uint16
+	Uint64  uint64
+	Float32 float32
+}
+
+func TestXML2RPCNumbers(t *testing.T) {
+	req := new(StructNumbersXML2RPC)
+	err := xml2RPC("<methodResponse><params>"+
+		"<param><value><int>-8</int></value></param>"+
+		"<param><value><i8>1099511627776</i8></value></param>"+
+		"<param><value><i4>16</i4></value></param>"+
+		"<param><value><i8>34359738368</i8></value></param>"+
+		"<param><value><double>1.5</double></value></param>"+
+		"</params></methodResponse>", req)
+	if err != nil {
+		t.Error("XML2RPC conversion failed", err)
+	}
+	expected := &StructNumbersXML2RPC{-8, 1 << 40, 16, 1 << 35, 1.5}
+	if !reflect.DeepEqual(req, expected) {
+		t.Error("XML2RPC numbers conversion failed")
+		t.Error("Expected", expected)
+		t.Error("Got", req)
+	}
+}
+
+func TestXML2RPCNumbersOutOfRange(t *testing.T) {
+	tests := []struct {
+		xml    string
+		target interface{}
+	}{
+		{"<int>128</int>", new(int8)},
+		{"<int>-1</int>", new(uint)},
+		{"<i8>4294967296</i8>", new(uint32)},
+		{"<double>1e300</double>", new(float32)},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte("<value>"+tt.xml+"</value>"), tt.target)
+		fault := toFault(err)
+		if _, ok := err.(*DecodeError); !ok || !strings.Contains(fault.String, "out of range") {
+			t.Errorf("%s: expected out of range fault, but got: %v", tt.xml, err)
+		}
+	}
+}
+
+func TestXML2RPCDynamic(t *testing.T) {
+	var res struct {
+		Info  map[string]interface{}
+		Names map[string]string
+		List  []interface{}
+		Any   interface{}
+	}
+	err := xml2RPC("<methodResponse><params>"+
+		"<param><value><struct>"+
+		"<member><name>id</name><value><i4>1</i4></value></member>"+
+		"<member><name>big</name><value><i8>1099511627776</i8></value></member>"+
+		"<member><name>ratio</name><value><double>0.5</double></value></member>"+
+		"<member><name>ok</name><value><boolean>1</boolean></value></member>"+
+		"<member><name>when</name><value><dateTime.iso8601>20120717T14:08:55</dateTime.iso8601></value></member>"+
+		"<member><name>data</name><value><base64>eW91</base64></value></member>"+
+		"<member><name>name</name><value>bare</value></member>"+
+		"<member><name>none</name><value><nil/></value></member>"+
+		"<member><name>tags</name><value><array><data><value><string>a</string></value></data></array></value></member>"+
+		"</struct></value></param>"+
+		"<param><value><struct><member><name>first</name><value><string>Johnny</string></value></member></struct></value></param>"+
+		"<param><value><array><data><value><int>1</int></value><value><string>two</string></value></data></array></value></param>"+
+		"<param><value><struct><member><name>nested</name><value><struct></struct></value></member></struct></value></param>"+
+		"</params></methodResponse>", &res)
+	if err != nil {
+		t.Error("XML2RPC conversion failed", err)
+	}
+
+	expectedInfo := map[string]interface{}{
+		"id":    1,
+		"big":   int64(1099511627776),
+		"ratio": 0.5,
+		"ok":    true,
+		"when":  time.Date(2012, time.July, 17, 14, 8, 55, 0, time.UTC),
+		"data":  []byte("you"),
+		"name":  "bare",
+		"none":  nil,
+		"tags":  []interface{}{"a"},
+	}
+	if !reflect.DeepEqual(res.Info, expectedInfo) {
+		t.Error("XML2RPC dynamic conversion failed")
+		t.Error("Expected", expectedInfo)
+		t.Error("Got", res.Info)
+	}
+	if !reflect.DeepEqual(res.Names, map[string]string{"first": "Johnny"}) {
+		t.Error("Wrong map:", res.Names)
+	}
+	if !reflect.DeepEqual(res.List, []interface{}{1, "two"}) {
+		t.Error("Wrong list:", res.List)
+	}
+	expectedAny := map[string]interface{}{"nested": map[string]interface{}{}}
+	if !reflect.DeepEqual(res.Any, expectedAny) {
+		t.Error("Wrong value:", res.Any)
+	}
+}
+
+func TestXML2RPCDateTime(t *testing.T) {
+	plus2 := time.FixedZone("", 2*60*60)
+	minus0330 := time.FixedZone("", -(3*60*60 + 30*60))
+	tests := []struct {
+		text     string
+		expected time.Time
+	}{
+		{"20240102T03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"20240102T030405", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02T03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{" 2024-01-02T03:04:05Z ", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02T03:04:05.250Z", time.Date(2024, 1, 2, 3, 4, 5, 250000000, time.UTC)},
+		{"2024-01-02T03:04:05,5+02:00", time.Date(2024, 1, 2, 3, 4, 5, 500000000, plus2)},
+		{"20240102T03:04:05+0200", time.Date(2024, 1, 2, 3, 4, 5, 0, plus2)},
+		{"20240102T03:04:05+02", time.Date(2024, 1, 2, 3, 4, 5, 0, plus2)},
+		{"20240102T03:04:05-03:30", time.Date(2024, 1, 2, 3, 4, 5, 0, minus0330)},
+		{"20240102T03:04:05+00:00", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		decoder := NewDecoder(strings.NewReader("<value><dateTime.iso8601>" + test.text + "</dateTime.iso8601></value>"))
+		var got time.Time
+		if err := decoder.Decode(&got); err != nil {
+			t.Errorf("%q: decode failed: %v", test.text, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.text, test.expected, got)
+		}
+		_, offset := got.Zone()
+		_, expectedOffset := test.expected.Zone()
+		if offset != expectedOffset {
+			t.Errorf("%q: expected zone of %v, got %v", test.text, test.expected, got)
+		}
+	}
+
+	for _, text := range []string{"2024-01-02", "20240102T03:04", "20240102T03:04:05+2", "20240102T03:04:05+02:0x", "2024-01-02T03:04:05+25:00", "20240102T03:04:05+0260", "20240102T03:04:05++1:00"} {
+		var got time.Time
+		if err := Unmarshal([]byte("<value><dateTime.iso8601>"+text+"</dateTime.iso8601></value>"), &got); err == nil {
+			t.Errorf("%q: expected error, got %v", text, got)
+		}
+	}
+}
+
+func TestXML2RPCPointers(t *testing.T) {
+	type Pointers struct {
+		Name  *string
+		Age   **int
+		Owner *Person
+		Tags  []string
+		Info  map[string]int
+	}
+	oldName := "old"
+	res := Pointers{
+		Name:  &oldName,
+		Owner: &Person{Name: "Jane"},
+		Tags:  []string{"a"},
+		Info:  map[string]int{"a": 1},
+	}
+	err := Unmarshal([]byte("<value><struct>"+
+		"<member><name>Name</name><value><string>Johnny</string></value></member>"+
+		"<member><name>Age</name><value><int>33</int></value></member>"+
+		"<member><name>Owner</name><value><nil/></value></member>"+
+		"<member><name>Tags</name><value><nil/></value></member>"+
+		"<member><name>Info</name><value><nil/></value></member>"+
+		"</struct></value>"), &res)
+	if err != nil {
+		t.Error("Unmarshal failed", err)
+	}
+	if res.Name != &oldName || oldName != "Johnny" {
+		t.Error("Name should be decoded into the existing string:", res.Name, oldName)
+	}
+	if res.Age == nil || *res.Age == nil || **res.Age != 33 {
+		t.Error("Age should be allocated:", res.Age)
+	}
+	if res.Owner != nil || res.Tags != nil || res.Info != nil {
+		t.Error("<nil/> should set nil:", res.Owner, res.Tags, res.Info)
+	}
+}
+
+func TestXML2RPCDecodeErrors(t *testing.T) {
+	type Item struct {
+		Owner int
+	}
+	var res struct {
+		Name  string
+		Items []Item
+		Info  map[string]bool
+	}
+	tests := []struct {
+		xml      string
+		param    int
+		path     string
+		typ      string
+		value    string
+		expected string
+		message  string
+	}{
+		{"<param><value><int>abc</int></value></param>", 0, "", "int", "abc", "string",
+			`xml: cannot decode <int> "abc" into string (<string>) at params[0]: strconv.ParseInt: parsing "abc": invalid syntax`},
+		{"<param><value>name</value></param><param><value><array><data>" +
+			"<value><struct><member><name>owner</name><value><int>1</int></value></member></struct></value>" +
+			"<value><struct><member><name>owner</name><value><string>2</string></value></member></struct></value>" +
+			"</data></array></value></param>", 1, "[1].owner", "string", "2", "int",
+			`xml: cannot decode <string> "2" into int (<int>) at params[1][1].owner: -32602: Invalid Method Parameters: fields type mismatch: string != int`},
+		{"<param><value>name</value></param><param><value><array><data></data></array></value></param>" +
+			"<param><value><struct><member><name>ok</name><value><boolean>yes</boolean></value></member></struct></value></param>", 2, ".ok", "boolean", "yes", "boolean",
+			`xml: cannot decode <boolean> "yes" into bool (<boolean>) at params[2].ok: invalid boolean "yes"`},
+	}
+	for _, test := range tests {
+		err := xml2RPC("<methodResponse><params>"+test.xml+"</params></methodResponse>", &res)
+		de, ok := err.(*DecodeError)
+		if !ok {
+			t.Errorf("expected DecodeError, but got: %v", err)
+			continue
+		}
+		if de.Param != test.param || de.Path != test.path || de.Type != test.typ || de.Value != test.value || de.Expected != test.expected {
+			t.Errorf("wrong DecodeError: %#v", de)
+		}
+		if de.Error() != test.message {
+			t.Errorf("expected %q, but got %q", test.message, de.Error())
+		}
+	}
+
+	err := xml2RPC("<methodResponse>\n<params>\n<param><value><int>1</int></param>\n</params></methodResponse>", &res)
+	de, ok := err.(*DecodeError)
+	if !ok || de.Line != 3 || de.Column != 34 || de.GoType != nil {
+		t.Fatalf("expected DecodeError at 3:34, but got: %v", err)
+	}
+	if _, ok := de.Err.(*xml.SyntaxError); !ok {
+		t.Errorf("expected an underlying SyntaxError, but got: %v", de.Err)
+	}
+	fault := toFault(err)
+	if fault.Code != FaultDecode.Code || !strings.HasPrefix(fault.String, FaultDecode.String+": line 3, column 34: ") {
+		t.Errorf("wrong fault: %v", fault)
+	}
+}
+
+type StrictMember struct {
+	ID   int    `xmlrpc:"id,required"`
+	Name string `xmlrpc:"name"`
+}
+
+type StrictArgs struct {
+	Member StrictMember
+	Count  int `xmlrpc:",required"`
+	Note   string
+}
+
+func TestXML2RPCStrict(t *testing.T) {
+	tests := []struct {
+		params string
+		err    string
+	}{
+		{"<param><value><struct><member><name>id</name><value><int>1</int></value></member><member><name>name</name><value>a</value></member></struct></value></param>" +
+			"<param><value><int>2</int></value></param>", ""},
+		{"<param><value><struct><member><name>id</name><value><int>1</int></value></member><member><name>other</name><value>a</value></member></struct></value></param>" +
+			"<param><value><int>2</int></value></param>", `Invalid Method Parameters: unknown member "other" at params[0]`},
+		{"<param><value><struct><member><name>id</name><value><int>1</int></value></member><member><name>id</name><value><int>1</int></value></member></struct></value></param>" +
+			"<param><value><int>2</int></value></param>", `Invalid Method Parameters: duplicate member "id" at params[0]`},
+		{"<param><value><struct><member><name>name</name><value>a</value></member></struct></value></param>" +
+			"<param><value><int>2</int></value></param>", `Invalid Method Parameters: missing required member "id" at params[0]`},
+		{"<param><value><struct><member><name>id</name><value><int>1</int></value></member></struct></value></param>",
+			`Invalid Method Parameters: missing required param 1 (Count)`},
+	}
+	for _, test := range tests {
+		response := "<methodResponse><params>" + test.params + "</params></methodResponse>"
+
+		var lenient StrictArgs
+		if err := xml2RPC(response, &lenient); err != nil {
+			t.Errorf("%s: lenient decoding failed: %v", test.params, err)
+		}
+
+		var strict StrictArgs
+		decoder := NewDecoder(strings.NewReader(response))
+		decoder.SetStrict(true)
+		err := decoder.DecodeResponse(&strict)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: strict decoding failed: %v", test.params, err)
+			}
+			continue
+		}
+		if err == nil || toFault(err).String != test.err {
+			t.Errorf("%s: expected %q, but got %v", test.params, test.err, err)
+		}
+	}
+
+	decoder := NewDecoder(strings.NewReader("<value><struct>" +
+		"<member><name>a</name><value><int>1</int></value></member>" +
+		"<member><name>a</name><value><int>2</int></value></member>" +
+		"</struct></value>"))
+	decoder.SetStrict(true)
+	var m map[string]int
+	if err := decoder.Decode(&m); err == nil || toFault(err).String != `Invalid Method Parameters: duplicate member "a" at value` {
+		t.Errorf("expected duplicate member error, but got %v", err)
+	}
+}
+
+func TestXML2RPCArrays(t *testing.T) {
+	type Item struct {
+		Name string
+	}
+	var got struct {
+		Ints    []int
+		Fixed   [2]string
+		Items   []*Item
+		Structs []Item
+		Nested  [][]int
+		Empty   []int
+	}
+	got.Ints = []int{7, 8, 9}
+	got.Empty = []int{1}
+
+	err := Unmarshal([]byte("<value><struct>"+
+		"<member><name>Ints</name><value><array><data><value><int>1</int></value><value><int>2</int></value></data></array></value></member>"+
+		"<member><name>Fixed</name><value><array><data><value>a</value><value>b</value></data></array></value></member>"+
+		"<member><name>Items</name><value><array><data><value><struct><member><name>Name</name><value>x</value></member></struct></value><value><nil/></value></data></array></value></member>"+
+		"<member><name>Structs</name><value><array><data><value><struct><member><name>Name</name><value>y</value></member></struct></value></data></array></value></member>"+
+		"<member><name>Nested</name><value><array><data><value><array><data><value><int>1</int></value></data></array></value><value><array><data></data></array></value></data></array></value></member>"+
+		"<member><name>Empty</name><value><array><data></data></array></value></member>"+
+		"</struct></value>"), &got)
+	if err != nil {
+		t.Fatal("Unmarshal failed", err)
+	}
+	if !reflect.DeepEqual(got.Ints, []int{1, 2}) {
+		t.Error("Ints should be replaced, got", got.Ints)
+	}
+	if got.Fixed != [2]string{"a", "b"} {
+		t.Error("Wrong Fixed:", got.Fixed)
+	}
+	if len(got.Items) != 2 || got.Items[0] == nil || got.Items[0].Name != "x" || got.Items[1] != nil {
+		t.Errorf("Wrong Items: %v", got.Items)
+	}
+	if !reflect.DeepEqual(got.Structs, []Item{{"y"}}) {
+		t.Error("Wrong Structs:", got.Structs)
+	}
+	if !reflect.DeepEqual(got.Nested, [][]int{{1}, {}}) {
+		t.Error("Wrong Nested:", got.Nested)
+	}
+	if got.Empty == nil || len(got.Empty) != 0 {
+		t.Error("Empty should be reset, got", got.Empty)
+	}
+
+	tests := []struct {
+		xml    string
+		target interface{}
+		err    string
+	}{
+		{"<array><data><value>a</value></data></array>", new([2]string), "array length mismatch: 1 != 2"},
+		{"<array><data><value>a</value></data></array>", new(int), "array fields mismatch: int != array"},
+		{"<array><data><value><int>1</int></value><value>b</value></data></array>", new([]int), "at value[1]"},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte("<value>"+tt.xml+"</value>"), tt.target)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.xml, tt.err, err)
+		}
+	}
+
+	fixed := [2]int{5, 6}
+	if err := Unmarshal([]byte("<value><array><data><value><int>1</int></value><value>b</value></data></array></value>"), &fixed); err == nil || fixed != [2]int{5, 6} {
+		t.Error("a failed decoding should leave the array untouched, got", fixed, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/rpc"
@@ -115,7 +116,12 @@ func execute(t *testing.T, s *rpc.Server, method string, req, res interface{}) e
 	if !s.HasMethod(method) {
 		t.Fatal("Expected to be registered:", method)
 	}
+	return executeAny(s, method, req, res)
+}
 
+// executeAny is execute for the method names gorilla/rpc doesn't know, such
+// as the system.* methods, aliases and names left to a method mapper.
+func executeAny(s *rpc.Server, method string, req, res interface{}) error {
 	buf, _ := EncodeClientRequest(method, req)
 	body := bytes.NewBuffer(buf)
 	r, _ := http.NewRequest("POST", "http://localhost:8080/", body)
@@ -127,6 +133,15 @@ func execute(t *testing.T, s *rpc.Server, method string, req, res interface{}) e
 	return DecodeClientResponse(w.Body, res)
 }
 
+// post posts the request body to s, and returns the response.
+func post(s http.Handler, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "http://localhost:8080/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/xml")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
 func TestRPC2XMLConverter(t *testing.T) {
 	req := &Service1Request{4, 2}
 	xml, err := rpcRequest2XML("Some.Method", req)
@@ -220,3 +235,80 @@ func TestServices(t *testing.T) {
 		t.Errorf("Wrong response: %v.", res3.Info)
 	}
 }
+
+type Service3StrictRequest struct {
+	Person struct {
+		Name  string
+		Extra string
+	}
+}
+
+// CountingService counts the calls of its method.
+type CountingService struct {
+	calls int
+}
+
+func (s *CountingService) GetInfo(r *http.Request, req *Service3Request, res *Service3Response) error {
+	s.calls++
+	return nil
+}
+
+func TestStrictCodec(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	codec.SetStrict(true)
+	s.RegisterCodec(codec, "text/xml")
+	service := new(CountingService)
+	s.RegisterService(service, "")
+
+	requests := []struct {
+		body, message string
+	}{
+		{
+			"<methodCall><methodName>CountingService.GetInfo</methodName><params><param><value><struct>" +
+				"<member><name>Extra</name><value><string>x</string></value></member>" +
+				"</struct></value></param></params></methodCall>",
+			`unknown member "Extra"`,
+		},
+		{
+			"<methodCall><methodName>CountingService.GetInfo</methodName><params><param><value><struct>" +
+				"<member><name>Age</name><value><int>abc</int></value></member>" +
+				"</struct></value></param></params></methodCall>",
+			"params[0].Age",
+		},
+	}
+	for _, request := range requests {
+		w := post(s, request.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), request.message) {
+			t.Errorf("wrong response: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if service.calls != 0 {
+		t.Errorf("a rejected request called the method %d times", service.calls)
+	}
+}
+
+type Service1StringRequest struct {
+	A string
+	B string
+}
+
+func TestCoercionCodec(t *testing.T) {
+	s := rpc.NewServer()
+	codec := NewCodec()
+	s.RegisterCodec(codec, "text/xml")
+	s.RegisterService(new(Service1), "")
+
+	var res Service1Response
+	if err := execute(t, s, "Service1.Multiply", &Service1StringRequest{"4", "2"}, &res); err == nil {
+		t.Error("expected a type mismatch without coercion")
+	}
+
+	codec.SetCoercion(CoerceNumericStrings)
+	if err := execute(t, s, "Service1.Multiply", &Service1StringRequest{"4", "2"}, &res); err != nil {
+		t.Error("Expected err to be nil, but got:", err)
+	}
+	if res.Result != 8 {
+		t.Errorf("Wrong response: %v.", res.Result)
+	}
+}